@@ -0,0 +1,134 @@
+package lid
+
+import (
+	"strconv"
+	"time"
+)
+
+// ------------------------------------------------------------
+// AUDIT-LOG
+
+// AuditLog stores the history of lock ownership.
+type AuditLog interface {
+	// Record adds an event to the log.
+	Record(event AuditEvent) error
+
+	// Query answers the events for the signature with a time in the
+	// range [from, to), oldest first. A zero to means no upper limit.
+	Query(signature string, from, to time.Time) ([]AuditEvent, error)
+}
+
+// AuditEvent describes a single change in the ownership of a lock.
+type AuditEvent struct {
+	Signature      string      `json:"signature,omitempty"`
+	Signee         string      `json:"signee,omitempty"`
+	Level          int         `json:"level,omitempty"`
+	Action         AuditAction `json:"action,omitempty"`
+	PreviousSignee string      `json:"previous_signee,omitempty"` // The owner that lost the lock, for transfer and force events
+	Time           time.Time   `json:"time,omitempty"`
+}
+
+// AuditOpts provides options for the audit middleware.
+type AuditOpts struct {
+	Clock   Clock                   // The source of event times. Defaults to SystemClock.
+	OnError func(AuditEvent, error) // Optional. Called when an event can't be recorded.
+}
+
+// ------------------------------------------------------------
+// AUDIT-MIDDLEWARE
+
+// WithAudit answers a middleware that records every change of lock
+// ownership to the log. A failure to record does not fail the lock
+// operation; it is reported to AuditOpts.OnError.
+func WithAudit(log AuditLog, opts AuditOpts) Middleware {
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return func(next Service) Service {
+		return preserve(&auditService{next: next, log: log, opts: opts}, next)
+	}
+}
+
+type auditService struct {
+	next Service
+	log  AuditLog
+	opts AuditOpts
+}
+
+func (s *auditService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	resp, err := s.next.Lock(req, opts)
+	if err != nil {
+		return resp, err
+	}
+	event := AuditEvent{Signature: req.Signature, Signee: req.Signee, Level: req.Level, PreviousSignee: resp.PreviousSignee}
+	switch resp.Status {
+	case LockOk:
+		event.Action = AuditAcquire
+	case LockRenewed:
+		event.Action = AuditRenew
+	case LockTransferred:
+		event.Action = AuditTransfer
+		if opts != nil && opts.Force {
+			event.Action = AuditForce
+		}
+	default:
+		return resp, err
+	}
+	s.record(event)
+	return resp, err
+}
+
+func (s *auditService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	resp, err := s.next.Unlock(req, opts)
+	if err == nil && resp.Status == UnlockOk {
+		s.record(AuditEvent{Signature: req.Signature, Signee: req.Signee, Action: AuditRelease})
+	}
+	return resp, err
+}
+
+func (s *auditService) Check(signature string) (CheckResponse, error) {
+	return s.next.Check(signature)
+}
+
+func (s *auditService) Unwrap() Service {
+	return s.next
+}
+
+func (s *auditService) record(event AuditEvent) {
+	event.Time = s.opts.Clock.Now()
+	err := s.log.Record(event)
+	if err != nil && s.opts.OnError != nil {
+		s.opts.OnError(event, err)
+	}
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+// AuditAction describes the change in an AuditEvent.
+type AuditAction int
+
+// The audit actions.
+const (
+	AuditAcquire  AuditAction = iota + 1 // The lock was free, now the signee owns it
+	AuditRenew                           // The signee owned the lock and still does
+	AuditTransfer                        // The lock was taken from the previous signee by level or expiry
+	AuditRelease                         // The signee unlocked the lock
+	AuditForce                           // The lock was taken from the previous signee by force
+)
+
+func (a AuditAction) String() string {
+	switch a {
+	case AuditAcquire:
+		return "Acquire"
+	case AuditRenew:
+		return "Renew"
+	case AuditTransfer:
+		return "Transfer"
+	case AuditRelease:
+		return "Release"
+	case AuditForce:
+		return "Force"
+	}
+	return "AuditAction(" + strconv.Itoa(int(a)) + ")"
+}
@@ -0,0 +1,200 @@
+package lidaws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hackborn/lid"
+	"math/rand"
+	"time"
+)
+
+// ------------------------------------------------------------
+// AWS-AUDIT-LOG
+
+// awsAuditLog provides a lid.AuditLog on a DynamoDB table,
+// a companion to the lock table.
+type awsAuditLog struct {
+	db    *dynamodb.DynamoDB
+	table string
+}
+
+// NewAuditLogFromSession constructs a new audit log on the named table,
+// creating the table if it doesn't exist. I will internally manage my
+// own connection to a DynamoDB client.
+func NewAuditLogFromSession(table string, sess *session.Session) (lid.AuditLog, error) {
+	return _newAuditLogFromSession(table, sess)
+}
+
+func _newAuditLogFromSession(table string, sess *session.Session) (*awsAuditLog, error) {
+	if sess == nil {
+		return nil, errSessionRequired
+	}
+	if table == "" {
+		return nil, errTableRequired
+	}
+	db := dynamodb.New(sess)
+	if db == nil {
+		return nil, errDynamoRequired
+	}
+	l := &awsAuditLog{db: db, table: table}
+	err := l.createTable()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *awsAuditLog) Record(event lid.AuditEvent) error {
+	r := awsAuditRecord{
+		Signature:      event.Signature,
+		Key:            auditKey(event.Time) + fmt.Sprintf("#%08x", rand.Uint32()),
+		TimeEpoch:      event.Time.UnixNano(),
+		Signee:         event.Signee,
+		Level:          event.Level,
+		Action:         int(event.Action),
+		PreviousSignee: event.PreviousSignee,
+	}
+	atts, err := dynamodbattribute.MarshalMap(r)
+	if err != nil {
+		return err
+	}
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item:      atts,
+	}
+	_, err = l.db.PutItem(params)
+	return transientErr(err)
+}
+
+func (l *awsAuditLog) Query(signature string, from, to time.Time) ([]lid.AuditEvent, error) {
+	b := awsBuilder{condition: awsAuditSignatureKey + ` = :sig AND ` + awsAuditSortKey + ` >= :from`}
+	b = b.value(":sig", signature).value(":from", auditKey(from))
+	if !to.IsZero() {
+		b.condition = awsAuditSignatureKey + ` = :sig AND ` + awsAuditSortKey + ` BETWEEN :from AND :to`
+		// The sort key has a suffix, so the bare key sorts before every event at that time.
+		b = b.value(":to", auditKey(to))
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	params := &dynamodb.QueryInput{
+		TableName:                 aws.String(l.table),
+		KeyConditionExpression:    aws.String(b.condition),
+		ExpressionAttributeValues: b.values,
+		ConsistentRead:            aws.Bool(true),
+	}
+
+	var events []lid.AuditEvent
+	for {
+		resp, err := l.db.Query(params)
+		if err != nil {
+			return nil, transientErr(err)
+		}
+		for _, item := range resp.Items {
+			r := awsAuditRecord{}
+			err = dynamodbattribute.UnmarshalMap(item, &r)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, r.event())
+		}
+		if len(resp.LastEvaluatedKey) < 1 {
+			return events, nil
+		}
+		params.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// createTable() creates my audit table.
+func (l *awsAuditLog) createTable() error {
+	params := &dynamodb.CreateTableInput{
+		TableName: aws.String(l.table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(awsAuditSignatureKey), AttributeType: aws.String("S")},
+			{AttributeName: aws.String(awsAuditSortKey), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(awsAuditSignatureKey), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String(awsAuditSortKey), KeyType: aws.String("RANGE")},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+	_, err := l.db.CreateTable(params)
+	if err != nil {
+		// Indicates the table already exists.
+		if isAwsErrorCode(err, dynamodb.ErrCodeResourceInUseException) {
+			return nil
+		}
+		return err
+	}
+	cond := func() bool {
+		return tableStatus(l.db, l.table) == awsReady
+	}
+	return wait(cond)
+}
+
+// deleteTable() deletes my audit table. It's used by testing but should not be used otherwise.
+func (l *awsAuditLog) deleteTable() {
+	params := &dynamodb.DeleteTableInput{
+		TableName: aws.String(l.table),
+	}
+	_, err := l.db.DeleteTable(params)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+			return
+		}
+		panic("Error deleting table: " + err.Error())
+	}
+	cond := func() bool {
+		return tableStatus(l.db, l.table) == awsMissing
+	}
+	lid.MustErr(wait(cond))
+}
+
+// ------------------------------------------------------------
+// AWS-AUDIT-RECORD
+
+// awsAuditRecord stores a single event in the audit table.
+type awsAuditRecord struct {
+	Signature      string `json:"asig"`            // The ID of the lock. MUST MATCH awsAuditSignatureKey
+	Key            string `json:"akey"`            // The time of the event with a random suffix, so events sort by time and never collide. MUST MATCH awsAuditSortKey
+	TimeEpoch      int64  `json:"atime"`           // The time of the event (epoch).
+	Signee         string `json:"asignee"`         // The owner after the event.
+	Level          int    `json:"alevel"`          // The level of the lock.
+	Action         int    `json:"aaction"`         // The lid.AuditAction
+	PreviousSignee string `json:"aprev,omitempty"` // The former owner.
+}
+
+func (r awsAuditRecord) event() lid.AuditEvent {
+	return lid.AuditEvent{
+		Signature:      r.Signature,
+		Signee:         r.Signee,
+		Level:          r.Level,
+		Action:         lid.AuditAction(r.Action),
+		PreviousSignee: r.PreviousSignee,
+		Time:           time.Unix(0, r.TimeEpoch),
+	}
+}
+
+// auditKey() answers the sortable form of a time.
+func auditKey(t time.Time) string {
+	if t.IsZero() || t.UnixNano() < 0 {
+		return fmt.Sprintf("%020d", 0)
+	}
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	awsAuditSignatureKey = "asig"
+	awsAuditSortKey      = "akey"
+)
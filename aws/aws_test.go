@@ -1,12 +1,20 @@
 package lidaws
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/hackborn/lid"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -20,6 +28,357 @@ func TestService(t *testing.T) {
 	lid.RunTestServiceSuite(t, suites)
 }
 
+// TestAuditLog verifies recording and querying the audit table.
+func TestAuditLog(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	l, err := _newAuditLogFromSession("lidtest_audit_"+randomString(12), makeTestSession(t))
+	lid.MustErr(err)
+	defer l.deleteTable()
+
+	at := func(sec int64) time.Time { return time.Unix(1000+sec, 0) }
+	events := []lid.AuditEvent{
+		{Signature: "a", Signee: "0", Action: lid.AuditAcquire, Time: at(0)},
+		{Signature: "b", Signee: "0", Action: lid.AuditAcquire, Time: at(1)},
+		{Signature: "a", Signee: "1", Level: 1, Action: lid.AuditTransfer, PreviousSignee: "0", Time: at(2)},
+		{Signature: "a", Signee: "1", Action: lid.AuditRelease, Time: at(3)},
+	}
+	for _, e := range events {
+		lid.MustErr(l.Record(e))
+	}
+	have, err := l.Query("a", at(0), at(3))
+	lid.MustErr(err)
+	want := []lid.AuditEvent{events[0], events[2]}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatal("have", have, "want", want)
+	}
+}
+
+// TestExistingTable verifies using a table with a custom schema
+// without creating it, and the errors for a missing or mismatched table.
+func TestExistingTable(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	sess := makeTestSession(t)
+	schema := AwsSchema{Signature: "pk", Signee: "owner", Level: "lvl", Expires: "exp", TimeToLive: "ttl", Written: "written"}
+	opts := lid.ServiceOpts{Table: "lidtest_" + randomString(12), Duration: time.Second * 10}
+
+	_, err := _newAwsServiceFromSession(opts, AwsOpts{SkipCreate: true, Schema: schema}, sess)
+	if err != errTableMissing {
+		t.Fatal("missing table has", err)
+	}
+	created, err := _newAwsServiceFromSession(opts, AwsOpts{Schema: schema}, sess)
+	lid.MustErr(err)
+	defer created.deleteTable()
+
+	s, err := _newAwsServiceFromSession(opts, AwsOpts{SkipCreate: true, Schema: schema}, sess)
+	lid.MustErr(err)
+	resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if resp.Status != lid.LockOk {
+		t.Fatal("lock has", resp)
+	}
+	_, err = _newAwsServiceFromSession(opts, AwsOpts{SkipCreate: true}, sess)
+	if err != errSchemaMismatch {
+		t.Fatal("mismatched schema has", err)
+	}
+	var drift []AwsDrift
+	_, err = _newAwsServiceFromSession(opts, AwsOpts{SkipCreate: true, Schema: schema, WriteCapacity: 20, OnDrift: func(d []AwsDrift) { drift = d }}, sess)
+	lid.MustErr(err)
+	if want := []AwsDrift{{"WriteCapacity", "20", "5"}}; !reflect.DeepEqual(drift, want) {
+		t.Fatal("drift has", drift, "want", want)
+	}
+}
+
+// TestNamespaces verifies locks in different namespaces of one
+// table are isolated, and listing a namespace.
+func TestNamespaces(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	opts := lid.ServiceOpts{Table: "lidtest_" + randomString(12), Duration: time.Second * 10}
+	s, err := _newAwsServiceFromSession(opts, AwsOpts{Schema: AwsSchema{Namespace: "lns"}}, makeTestSession(t))
+	lid.MustErr(err)
+	defer s.deleteTable()
+	a, err := s.Namespace("a")
+	lid.MustErr(err)
+	b, err := s.Namespace("b")
+	lid.MustErr(err)
+
+	lock := func(ns lid.Service, sig, signee string, want lid.LockResponseStatus) {
+		resp, err := ns.Lock(lid.LockRequest{Signature: sig, Signee: signee}, nil)
+		if resp.Status != want || (err != nil) != (want == lid.LockFailed) {
+			t.Fatal("lock", sig, signee, "has", resp, err, "want", want)
+		}
+	}
+	lock(a, "x", "0", lid.LockOk)
+	lock(b, "x", "1", lid.LockOk)
+	lock(a, "y", "0", lid.LockOk)
+	lock(a, "x", "1", lid.LockFailed)
+	resp, err := b.Unlock(lid.UnlockRequest{Signature: "x", Signee: "1"}, nil)
+	if err != nil || resp.Status != lid.UnlockOk {
+		t.Fatal("unlock has", resp, err)
+	}
+	check, err := a.Check("x")
+	if err != nil || check.Signee != "0" {
+		t.Fatal("check has", check, err)
+	}
+
+	list, err := a.List()
+	lid.MustErr(err)
+	if len(list) != 2 || list[0].Signature != "x" || list[1].Signature != "y" || list[0].Signee != "0" {
+		t.Fatal("list a has", list)
+	}
+	list, err = b.List()
+	lid.MustErr(err)
+	if len(list) != 0 {
+		t.Fatal("list b has", list)
+	}
+}
+
+// TestNamespaceErrors verifies a namespace needs a name, and a schema with a namespace key.
+func TestNamespaceErrors(t *testing.T) {
+	s := &awsService{schema: AwsSchema{}.withDefaults()}
+	if _, err := s.Namespace("a"); err != errNamespaceUnsupported {
+		t.Fatal("have", err)
+	}
+	if _, err := s.List(); err != errNamespaceUnsupported {
+		t.Fatal("have", err)
+	}
+	s.schema.Namespace = "lns"
+	if _, err := s.Namespace(""); err != errNamespaceRequired {
+		t.Fatal("have", err)
+	}
+	ns, err := s.Namespace("a")
+	lid.MustErr(err)
+	if ns.(*awsService).namespace != "a" || s.namespace != "" {
+		t.Fatal("view has", ns)
+	}
+}
+
+// TestSchema verifies items written and read with custom attribute names.
+func TestSchema(t *testing.T) {
+	schema := AwsSchema{Signature: "pk", Level: "lvl"}.withDefaults()
+	want := awsRecord{Signature: "a", Signee: "0", Level: 2, ExpiresEpoch: 10, Ttl: 20, WrittenEpoch: 5}
+	item := schema.item(want)
+	for _, name := range []string{"pk", "lsignee", "lvl", "lexpires", "lttl", "lwritten"} {
+		if item[name] == nil {
+			t.Fatal("item missing", name, item)
+		}
+	}
+	have, err := schema.record(item)
+	lid.MustErr(err)
+	if have != want {
+		t.Fatal("have", have, "want", want)
+	}
+	if b := schema.names(awsBuilder{condition: awsReleaseLockCond}); len(b.names) != 2 || *b.names["#sig"] != "pk" {
+		t.Fatal("release names have", b.names)
+	}
+
+	schema.Namespace = "ns"
+	want.Namespace = "a"
+	item = schema.item(want)
+	if item["ns"] == nil || *item["ns"].S != "a" {
+		t.Fatal("item missing namespace", item)
+	}
+	have, err = schema.record(item)
+	lid.MustErr(err)
+	if have != want {
+		t.Fatal("have", have, "want", want)
+	}
+}
+
+// TestValidateSchema verifies the table descriptions a schema accepts.
+func TestValidateSchema(t *testing.T) {
+	table := func(atype string, keys ...string) *dynamodb.TableDescription {
+		desc := &dynamodb.TableDescription{}
+		for i, k := range keys {
+			ktype := "HASH"
+			if i > 0 {
+				ktype = "RANGE"
+			}
+			desc.KeySchema = append(desc.KeySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(k), KeyType: aws.String(ktype)})
+			desc.AttributeDefinitions = append(desc.AttributeDefinitions, &dynamodb.AttributeDefinition{AttributeName: aws.String(k), AttributeType: aws.String(atype)})
+		}
+		return desc
+	}
+	cases := []struct {
+		Schema AwsSchema
+		Table  *dynamodb.TableDescription
+		Want   error
+	}{
+		{AwsSchema{}, table("S", "lsig"), nil},
+		{AwsSchema{Signature: "pk"}, table("S", "pk"), nil},
+		{AwsSchema{}, table("S", "pk"), errSchemaMismatch},
+		{AwsSchema{}, table("N", "lsig"), errSchemaMismatch},
+		{AwsSchema{}, table("S", "lsig", "sk"), errSchemaMismatch},
+		{AwsSchema{Namespace: "ns"}, table("S", "ns", "lsig"), nil},
+		{AwsSchema{Namespace: "ns"}, table("S", "lsig"), errSchemaMismatch},
+		{AwsSchema{Namespace: "ns"}, table("S", "lsig", "ns"), errSchemaMismatch},
+		{AwsSchema{Namespace: "ns"}, table("N", "ns", "lsig"), errSchemaMismatch},
+	}
+	for i, tc := range cases {
+		if have := tc.Schema.withDefaults().validate(tc.Table); have != tc.Want {
+			t.Fatal("case", i, "have", have, "want", tc.Want)
+		}
+	}
+}
+
+// TestCreateTableParams verifies the provisioning options are
+// applied to a new table.
+func TestCreateTableParams(t *testing.T) {
+	s := &awsService{opts: lid.ServiceOpts{Table: "locks"}, schema: AwsSchema{}.withDefaults()}
+	params := s.createTableParams()
+	if params.BillingMode != nil || *params.ProvisionedThroughput.ReadCapacityUnits != 10 || *params.ProvisionedThroughput.WriteCapacityUnits != 5 {
+		t.Fatal("default params have", params)
+	}
+	if params.SSESpecification != nil || params.StreamSpecification != nil || params.Tags != nil {
+		t.Fatal("default params have", params)
+	}
+
+	s.aopts = AwsOpts{BillingMode: dynamodb.BillingModePayPerRequest, KmsKeyId: "key", StreamViewType: dynamodb.StreamViewTypeKeysOnly, Tags: map[string]string{"b": "2", "a": "1"}}
+	params = s.createTableParams()
+	if *params.BillingMode != dynamodb.BillingModePayPerRequest || params.ProvisionedThroughput != nil {
+		t.Fatal("billing has", params)
+	}
+	if *params.SSESpecification.SSEType != dynamodb.SSETypeKms || *params.SSESpecification.KMSMasterKeyId != "key" {
+		t.Fatal("encryption has", params.SSESpecification)
+	}
+	if !*params.StreamSpecification.StreamEnabled || *params.StreamSpecification.StreamViewType != dynamodb.StreamViewTypeKeysOnly {
+		t.Fatal("stream has", params.StreamSpecification)
+	}
+	if len(params.Tags) != 2 || *params.Tags[0].Key != "a" || *params.Tags[1].Value != "2" {
+		t.Fatal("tags have", params.Tags)
+	}
+}
+
+// TestDrift verifies the settings of an existing table that
+// differ from the options are reported.
+func TestDrift(t *testing.T) {
+	table := &dynamodb.TableDescription{
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(10), WriteCapacityUnits: aws.Int64(5)},
+		SSEDescription:        &dynamodb.SSEDescription{Status: aws.String(dynamodb.SSEStatusEnabled), KMSMasterKeyArn: aws.String("arn:aws:kms:us-west-2:1:key/abc")},
+	}
+	cases := []struct {
+		Opts AwsOpts
+		Want []AwsDrift
+	}{
+		{AwsOpts{}, nil},
+		{AwsOpts{ReadCapacity: 10, WriteCapacity: 5, KmsKeyId: "abc"}, nil},
+		{AwsOpts{BillingMode: dynamodb.BillingModePayPerRequest}, []AwsDrift{{"BillingMode", "PAY_PER_REQUEST", "PROVISIONED"}}},
+		{AwsOpts{WriteCapacity: 20, KmsKeyId: "def"}, []AwsDrift{{"WriteCapacity", "20", "5"}, {"KmsKeyId", "def", "arn:aws:kms:us-west-2:1:key/abc"}}},
+		{AwsOpts{StreamViewType: dynamodb.StreamViewTypeNewImage}, []AwsDrift{{"StreamViewType", "NEW_IMAGE", ""}}},
+	}
+	for i, tc := range cases {
+		s := &awsService{aopts: tc.Opts}
+		have, err := s.drift(table)
+		lid.MustErr(err)
+		if !reflect.DeepEqual(have, tc.Want) {
+			t.Fatal("case", i, "have", have, "want", tc.Want)
+		}
+	}
+}
+
+// TestTableDrift verifies the drift of a table that lacks the options
+// compared with separate requests, i.e. tags and point-in-time recovery,
+// whether it's asked for or reported at construction.
+func TestTableDrift(t *testing.T) {
+	srv := newFakeTable(time.Now)
+	defer srv.Close()
+	aopts := AwsOpts{PointInTimeRecovery: true, Tags: map[string]string{"team": "locks"}}
+	have, err := TableDrift(lid.ServiceOpts{Table: "locks"}, aopts, newFakeSession(srv))
+	lid.MustErr(err)
+	want := []AwsDrift{{"PointInTimeRecovery", "true", "false"}, {"Tags.team", "locks", ""}}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatal("have", have, "want", want)
+	}
+
+	// The same drift is reported to OnDrift when the service opens the table.
+	have = nil
+	aopts.SkipCreate = true
+	aopts.OnDrift = func(drift []AwsDrift) {
+		have = drift
+	}
+	_, err = NewAwsServiceWithOpts(lid.ServiceOpts{Table: "locks", Duration: time.Second * 10}, aopts, newFakeSession(srv))
+	lid.MustErr(err)
+	if !reflect.DeepEqual(have, want) {
+		t.Fatal("OnDrift has", have, "want", want)
+	}
+}
+
+// TestParseAwsOpts verifies the AwsOpts in lid.Open URLs.
+func TestParseAwsOpts(t *testing.T) {
+	cases := []struct {
+		Query   string
+		Want    AwsOpts
+		WantErr error
+	}{
+		{"", AwsOpts{}, nil},
+		{"skip_create=true&billing_mode=PAY_PER_REQUEST&read_capacity=20&pitr=true", AwsOpts{SkipCreate: true, BillingMode: "PAY_PER_REQUEST", ReadCapacity: 20, PointInTimeRecovery: true}, nil},
+		{"tag.team=locks&tag.cost%20center=42&tag.empty=", AwsOpts{Tags: map[string]string{"team": "locks", "cost center": "42", "empty": ""}}, nil},
+		{"signee_attr=owner", AwsOpts{Schema: AwsSchema{Signee: "owner"}}, nil},
+		{"pitr=maybe", AwsOpts{}, errInvalidPitr},
+		{"tag.=locks", AwsOpts{}, errInvalidTag},
+		{"tag.team=a&tag.team=b", AwsOpts{}, errInvalidTag},
+	}
+	for i, tc := range cases {
+		q, err := url.ParseQuery(tc.Query)
+		lid.MustErr(err)
+		have, err := parseAwsOpts(q)
+		if err != tc.WantErr || (err == nil && !reflect.DeepEqual(have, tc.Want)) {
+			t.Fatal("case", i, "have", have, err, "want", tc.Want, tc.WantErr)
+		}
+	}
+}
+
+// TestPermissionError verifies access denied errors are reported
+// as a PermissionError.
+func TestPermissionError(t *testing.T) {
+	s := &awsService{opts: lid.ServiceOpts{Table: "locks"}}
+	err := s.requestErr("CreateTable", awserr.New(awsAccessDenied, "denied", nil))
+	perr, ok := err.(*PermissionError)
+	if !ok || perr.Action != "dynamodb:CreateTable" || perr.Table != "locks" {
+		t.Fatal("have", err)
+	}
+	err = s.requestErr("PutItem", awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil))
+	if !lid.IsTransient(err) {
+		t.Fatal("have", err)
+	}
+}
+
+// TestTracing verifies the DynamoDB requests are children of the
+// span in the call's context.
+func TestTracing(t *testing.T) {
+	srv := newFakeTable(time.Now)
+	defer srv.Close()
+	tracer := lid.NewRecordingTracer()
+	s := lid.WithTracing(tracer, "aws")(newFakeTableService(srv, lid.ServiceOpts{Table: "locks", Duration: time.Second * 10}))
+
+	root := tracer.Start(nil, "request")
+	ctx := lid.ContextWithSpan(context.Background(), tracer, root)
+	_, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, &lid.LockOpts{Context: ctx})
+	lid.MustErr(err)
+	_, err = s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, &lid.UnlockOpts{Context: ctx})
+	lid.MustErr(err)
+
+	names := make(map[int]string)
+	for _, span := range tracer.Spans() {
+		names[span.ID] = span.Name
+	}
+	parents := make(map[string]string)
+	for _, span := range tracer.Spans() {
+		parents[span.Name] = names[span.ParentID]
+	}
+	want := map[string]string{"dynamodb.PutItem": "lid.Lock", "dynamodb.DeleteItem": "lid.Unlock"}
+	for name, parent := range want {
+		if have, ok := parents[name]; !ok || have != parent {
+			t.Fatal("span", name, "has parent", have, "want", parent)
+		}
+	}
+}
+
 // ------------------------------------------------------------
 // SERVICE DEBUG
 
@@ -27,12 +386,17 @@ func (s *awsService) SetDuration(d time.Duration) {
 	s.opts.Duration = d
 }
 
+func (s *awsService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
 // ------------------------------------------------------------
 // TEST-CFG
 
 type awsServiceBootstrap struct {
 	tablename string
 	sess      *session.Session
+	namespace string // Run the suite in a namespace of a composite-key table.
 	service   *awsService
 }
 
@@ -42,12 +406,28 @@ func (b *awsServiceBootstrap) OpenService() lid.Service {
 	// * Not supported in local dynamodb? (verify; add test if it is)
 	// * Hosted dynamo has no guarantee on when the item is actually deleted.
 	opts := lid.ServiceOpts{Table: b.tablename, Duration: time.Second * 10}
-	service, err := _newAwsServiceFromSession(opts, b.sess)
+	aopts := AwsOpts{}
+	if b.namespace != "" {
+		aopts.Schema.Namespace = "lns"
+	}
+	service, err := _newAwsServiceFromSession(opts, aopts, b.sess)
 	lid.MustErr(err)
 	b.service = service
 	err = service.createTable()
 	lid.MustErr(err)
-	return service
+	if b.namespace == "" {
+		return service
+	}
+	// Another namespace holds the same signatures, which must not interfere.
+	other, err := service.Namespace("other")
+	lid.MustErr(err)
+	for _, sig := range []string{"a", "b", "c"} {
+		_, err = other.Lock(lid.LockRequest{Signature: sig, Signee: "other", Level: 100}, nil)
+		lid.MustErr(err)
+	}
+	ns, err := service.Namespace(b.namespace)
+	lid.MustErr(err)
+	return ns
 }
 
 func (b *awsServiceBootstrap) CloseService() error {
@@ -60,27 +440,61 @@ func (b *awsServiceBootstrap) CloseService() error {
 func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
 	var services []lid.ServiceBootstrap
 	if !testing.Short() {
-		// Currently we only test against a local dynamo.
-		awskey0 := "LID_TESTING_AWS_DYNAMO_ENDPOINT"
-
-		// Check that the system is properly configured
-		if os.Getenv(awskey0) == "" {
-			fmt.Println("Can't do integration test, must have envvar", awskey0, "(use -short to disable)")
-			t.Fatal()
-		}
-
-		val0 := os.Getenv(awskey0)
-
-		cfg := &aws.Config{}
-		cfg = cfg.WithRegion("us-west-2").WithEndpoint(val0)
-		sess := session.Must(session.NewSession(cfg))
+		sess := makeTestSession(t)
 		tablename := "lidtest_" + randomString(12)
 		bootstrap := &awsServiceBootstrap{tablename: tablename, sess: sess}
 		services = append(services, bootstrap)
+		bootstrap = &awsServiceBootstrap{tablename: tablename + "_ns", sess: sess, namespace: "suite"}
+		services = append(services, bootstrap)
 	}
 	return services
 }
 
+// makeTestSession makes the AWS session for the testing configuration.
+func makeTestSession(t *testing.T) *session.Session {
+	// Currently we only test against a local dynamo.
+	awskey0 := "LID_TESTING_AWS_DYNAMO_ENDPOINT"
+
+	// Check that the system is properly configured
+	if os.Getenv(awskey0) == "" {
+		fmt.Println("Can't do integration test, must have envvar", awskey0, "(use -short to disable)")
+		t.Fatal()
+	}
+
+	val0 := os.Getenv(awskey0)
+
+	cfg := &aws.Config{}
+	cfg = cfg.WithRegion("us-west-2").WithEndpoint(val0)
+	return session.Must(session.NewSession(cfg))
+}
+
+// newFakeTable answers a server that describes a table with the default
+// schema, and answers every other DynamoDB request with no item. Each
+// response is dated by the clock.
+func newFakeTable(now func() time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", now().UTC().Format(http.TimeFormat))
+		if r.Header.Get("X-Amz-Target") == "DynamoDB_20120810.DescribeTable" {
+			w.Write([]byte(`{"Table":{"TableArn":"arn:aws:dynamodb:us-west-2:1:table/locks","KeySchema":[{"AttributeName":"lsig","KeyType":"HASH"}],"AttributeDefinitions":[{"AttributeName":"lsig","AttributeType":"S"}]}}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+// newFakeTableService answers a service on a newFakeTable() server.
+func newFakeTableService(srv *httptest.Server, opts lid.ServiceOpts) lid.Service {
+	s, err := _newAwsServiceFromSession(opts, AwsOpts{SkipCreate: true}, newFakeSession(srv))
+	lid.MustErr(err)
+	return s
+}
+
+// newFakeSession answers a session on a newFakeTable() server.
+func newFakeSession(srv *httptest.Server) *session.Session {
+	cfg := &aws.Config{Region: aws.String("us-west-2"), Endpoint: aws.String(srv.URL), Credentials: credentials.NewStaticCredentials("id", "secret", "")}
+	return session.Must(session.NewSession(cfg))
+}
+
 func randomString(size int) string {
 	rs := rand.NewSource(time.Now().UnixNano())
 	r := rand.New(rs)
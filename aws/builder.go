@@ -14,10 +14,21 @@ import (
 type awsBuilder struct {
 	keys      map[string]*dynamodb.AttributeValue
 	condition string
+	names     map[string]*string
 	values    map[string]*dynamodb.AttributeValue
 	err       error
 }
 
+func (b awsBuilder) name(placeholder, name string) awsBuilder {
+	names := make(map[string]*string, len(b.names)+1)
+	for k, v := range b.names {
+		names[k] = v
+	}
+	names[placeholder] = aws.String(name)
+	b.names = names
+	return b
+}
+
 func (b awsBuilder) key(key string, value interface{}) awsBuilder {
 	dst, err := b.marshalToMap(key, value, b.keys)
 	b.keys = dst
@@ -54,6 +65,9 @@ func (b awsBuilder) put(dst *dynamodb.PutItemInput) {
 	if b.condition != "" {
 		dst.ConditionExpression = aws.String(b.condition)
 	}
+	if len(b.names) > 0 {
+		dst.ExpressionAttributeNames = b.names
+	}
 	if len(b.values) > 0 {
 		dst.ExpressionAttributeValues = b.values
 	}
@@ -66,6 +80,9 @@ func (b awsBuilder) delete(dst *dynamodb.DeleteItemInput) {
 	if b.condition != "" {
 		dst.ConditionExpression = aws.String(b.condition)
 	}
+	if len(b.names) > 0 {
+		dst.ExpressionAttributeNames = b.names
+	}
 	if len(b.values) > 0 {
 		dst.ExpressionAttributeValues = b.values
 	}
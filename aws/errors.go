@@ -4,6 +4,24 @@ import (
 	"errors"
 )
 
+// ------------------------------------------------------------
+// PERMISSION-ERROR
+
+// PermissionError describes a request the AWS credentials aren't allowed to make.
+type PermissionError struct {
+	Action string // The IAM action, i.e. "dynamodb:PutItem"
+	Table  string
+	Err    error // The original error
+}
+
+func (e *PermissionError) Error() string {
+	msg := "Permission denied: " + e.Action + " on table " + e.Table
+	if e.Action == "dynamodb:CreateTable" {
+		msg += " (use AwsOpts.SkipCreate with an existing table)"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
 // ------------------------------------------------------------
 // CONST and VAR
 
@@ -12,6 +30,13 @@ var (
 	errDurationRequired     = errors.New("Bad request: Duration required")
 	errDynamoRequired       = errors.New("Can't create DynamoDB")
 	errInitializationFailed = errors.New("Initialization failed")
+	errInvalidPitr          = errors.New("Bad request: Invalid " + pitrParam)
+	errInvalidSkipCreate    = errors.New("Bad request: Invalid " + skipCreateParam)
+	errInvalidTag           = errors.New("Bad request: Invalid " + tagParamPrefix + "<key>")
+	errNamespaceRequired    = errors.New("Bad request: Namespace required")
+	errNamespaceUnsupported = errors.New("Bad request: Namespaces require AwsSchema.Namespace")
+	errSchemaMismatch       = errors.New("Bad request: Table keys must be the strings named by AwsSchema.Namespace (partition, if set) and Signature")
 	errSessionRequired      = errors.New("Session is required")
+	errTableMissing         = errors.New("Bad request: Table doesn't exist")
 	errTableRequired        = errors.New("Bad request: Table name required")
 )
@@ -0,0 +1,108 @@
+package lidaws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hackborn/lid"
+	"time"
+)
+
+// ------------------------------------------------------------
+// NAMESPACES
+
+// Namespacer is implemented by the service. It partitions the lock table
+// into namespaces, so many applications can share a table without their
+// signatures colliding. The table needs a composite key, which is set
+// with AwsSchema.Namespace.
+type Namespacer interface {
+	// Namespace answers a view of the service whose locks are in the namespace.
+	Namespace(name string) (NamespaceService, error)
+}
+
+// NamespaceService is a view of the lock table restricted to one namespace.
+type NamespaceService interface {
+	lid.Service
+	Namespacer
+
+	// List answers every record in the namespace, including expired
+	// records the table hasn't deleted yet.
+	List() ([]LockRecord, error)
+}
+
+// LockRecord describes a single lock in the table.
+type LockRecord struct {
+	Signature string
+	Signee    string
+	Level     int
+	Expires   time.Time
+}
+
+func (s *awsService) Namespace(name string) (NamespaceService, error) {
+	if s.schema.Namespace == "" {
+		return nil, errNamespaceUnsupported
+	}
+	if name == "" {
+		return nil, errNamespaceRequired
+	}
+	view := *s
+	view.namespace = name
+	return &view, nil
+}
+
+func (s *awsService) List() ([]LockRecord, error) {
+	if s.schema.Namespace == "" {
+		return nil, errNamespaceUnsupported
+	}
+	b := awsBuilder{condition: `#ns = :ns`}
+	b = b.name("#ns", s.schema.Namespace).value(":ns", s.namespace)
+	if b.err != nil {
+		return nil, b.err
+	}
+	params := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.opts.Table),
+		KeyConditionExpression:    aws.String(b.condition),
+		ExpressionAttributeNames:  b.names,
+		ExpressionAttributeValues: b.values,
+		ConsistentRead:            aws.Bool(true),
+	}
+
+	// List takes no context, so the Query isn't traced.
+	span := s.startSpan(context.Background(), "Query")
+	defer span.End()
+	var records []LockRecord
+	for {
+		resp, err := s.db.Query(params)
+		if err != nil {
+			span.SetError(err)
+			return nil, s.requestErr("Query", err)
+		}
+		for _, item := range resp.Items {
+			r, err := s.schema.record(item)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, LockRecord{r.Signature, r.Signee, r.Level, time.Unix(0, r.ExpiresEpoch)})
+		}
+		if len(resp.LastEvaluatedKey) < 1 {
+			return records, nil
+		}
+		params.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// key() adds the key of the signature's record.
+func (s *awsService) key(b awsBuilder, signature string) awsBuilder {
+	if s.schema.Namespace != "" {
+		b = b.key(s.schema.Namespace, s.namespace)
+	}
+	return b.key(s.schema.Signature, signature)
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// The namespace of a service that wasn't answered by Namespace().
+	defaultNamespace = "default"
+)
@@ -0,0 +1,224 @@
+package lidaws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hackborn/lid"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// AWS-DRIFT
+
+// AwsDrift describes a table setting that differs from the AwsOpts.
+type AwsDrift struct {
+	Setting string // The AwsOpts field, i.e. "BillingMode", or "Tags.Name" for a tag.
+	Want    string
+	Have    string
+}
+
+func (d AwsDrift) String() string {
+	return d.Setting + " wants " + strconv.Quote(d.Want) + " but has " + strconv.Quote(d.Have)
+}
+
+// TableDrift answers the settings of an existing table that differ from the
+// provisioning options. Only the options that are set are compared. The table
+// isn't created or changed.
+func TableDrift(opts lid.ServiceOpts, aopts AwsOpts, sess *session.Session) ([]AwsDrift, error) {
+	if sess == nil {
+		return nil, errSessionRequired
+	}
+	if opts.Table == "" {
+		return nil, errTableRequired
+	}
+	s := &awsService{db: dynamodb.New(sess), opts: opts, aopts: aopts, schema: aopts.Schema.withDefaults()}
+	table, err := s.describeTable()
+	if err != nil {
+		return nil, err
+	}
+	return s.drift(table)
+}
+
+// ------------------------------------------------------------
+// AWS-SERVICE PROVISIONING
+
+// createTableParams() answers the parameters to create my table.
+func (s *awsService) createTableParams() *dynamodb.CreateTableInput {
+	params := &dynamodb.CreateTableInput{
+		TableName:            aws.String(s.opts.Table),
+		AttributeDefinitions: s.schema.attributes(),
+		KeySchema:            s.schema.keys(),
+	}
+	if s.aopts.BillingMode == dynamodb.BillingModePayPerRequest {
+		params.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	} else {
+		// Throughput doesn't really matter. Just about everyone should be using
+		// autoscaling, which you have to set manually.
+		params.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(orInt64(s.aopts.ReadCapacity, defaultReadCapacity)),
+			WriteCapacityUnits: aws.Int64(orInt64(s.aopts.WriteCapacity, defaultWriteCapacity)),
+		}
+	}
+	if s.aopts.KmsKeyId != "" {
+		params.SSESpecification = &dynamodb.SSESpecification{
+			Enabled:        aws.Bool(true),
+			SSEType:        aws.String(dynamodb.SSETypeKms),
+			KMSMasterKeyId: aws.String(s.aopts.KmsKeyId),
+		}
+	}
+	if s.aopts.StreamViewType != "" {
+		params.StreamSpecification = &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(s.aopts.StreamViewType),
+		}
+	}
+	for _, k := range sortedKeys(s.aopts.Tags) {
+		params.Tags = append(params.Tags, &dynamodb.Tag{Key: aws.String(k), Value: aws.String(s.aopts.Tags[k])})
+	}
+	return params
+}
+
+// enableBackups() turns on point-in-time recovery, if I want it.
+func (s *awsService) enableBackups() error {
+	if !s.aopts.PointInTimeRecovery {
+		return nil
+	}
+	params := &dynamodb.UpdateContinuousBackupsInput{
+		TableName: aws.String(s.opts.Table),
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(true),
+		},
+	}
+	_, err := s.db.UpdateContinuousBackups(params)
+	if err != nil {
+		return s.requestErr("UpdateContinuousBackups", err)
+	}
+	return nil
+}
+
+// drift() answers the settings of the table that differ from my options.
+func (s *awsService) drift(table *dynamodb.TableDescription) ([]AwsDrift, error) {
+	var drift []AwsDrift
+	add := func(setting, want, have string) {
+		if want != have {
+			drift = append(drift, AwsDrift{setting, want, have})
+		}
+	}
+
+	billing := dynamodb.BillingModeProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != nil {
+		billing = *table.BillingModeSummary.BillingMode
+	}
+	if s.aopts.BillingMode != "" {
+		add("BillingMode", s.aopts.BillingMode, billing)
+	}
+	if billing == dynamodb.BillingModeProvisioned && table.ProvisionedThroughput != nil {
+		if s.aopts.ReadCapacity > 0 {
+			add("ReadCapacity", strconv.FormatInt(s.aopts.ReadCapacity, 10), strconv.FormatInt(aws.Int64Value(table.ProvisionedThroughput.ReadCapacityUnits), 10))
+		}
+		if s.aopts.WriteCapacity > 0 {
+			add("WriteCapacity", strconv.FormatInt(s.aopts.WriteCapacity, 10), strconv.FormatInt(aws.Int64Value(table.ProvisionedThroughput.WriteCapacityUnits), 10))
+		}
+	}
+	if s.aopts.KmsKeyId != "" {
+		// The table reports the key ARN, which ends with the key id.
+		have := ""
+		if sse := table.SSEDescription; sse != nil && aws.StringValue(sse.Status) != dynamodb.SSEStatusDisabled {
+			have = aws.StringValue(sse.KMSMasterKeyArn)
+		}
+		if !strings.HasSuffix(have, s.aopts.KmsKeyId) {
+			add("KmsKeyId", s.aopts.KmsKeyId, have)
+		}
+	}
+	if s.aopts.StreamViewType != "" {
+		have := ""
+		if stream := table.StreamSpecification; stream != nil && aws.BoolValue(stream.StreamEnabled) {
+			have = aws.StringValue(stream.StreamViewType)
+		}
+		add("StreamViewType", s.aopts.StreamViewType, have)
+	}
+	if s.aopts.PointInTimeRecovery {
+		have, err := s.pointInTimeRecovery()
+		if err != nil {
+			return nil, err
+		}
+		add("PointInTimeRecovery", "true", strconv.FormatBool(have))
+	}
+	if len(s.aopts.Tags) > 0 {
+		have, err := s.tags(aws.StringValue(table.TableArn))
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range sortedKeys(s.aopts.Tags) {
+			add("Tags."+k, s.aopts.Tags[k], have[k])
+		}
+	}
+	return drift, nil
+}
+
+// pointInTimeRecovery() answers true if my table has point-in-time recovery.
+func (s *awsService) pointInTimeRecovery() (bool, error) {
+	params := &dynamodb.DescribeContinuousBackupsInput{
+		TableName: aws.String(s.opts.Table),
+	}
+	r, err := s.db.DescribeContinuousBackups(params)
+	if err != nil {
+		return false, s.requestErr("DescribeContinuousBackups", err)
+	}
+	desc := r.ContinuousBackupsDescription
+	if desc == nil || desc.PointInTimeRecoveryDescription == nil {
+		return false, nil
+	}
+	return aws.StringValue(desc.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus) == dynamodb.PointInTimeRecoveryStatusEnabled, nil
+}
+
+// tags() answers the tags on the table.
+func (s *awsService) tags(arn string) (map[string]string, error) {
+	tags := make(map[string]string)
+	params := &dynamodb.ListTagsOfResourceInput{
+		ResourceArn: aws.String(arn),
+	}
+	for {
+		r, err := s.db.ListTagsOfResource(params)
+		if err != nil {
+			return nil, s.requestErr("ListTagsOfResource", err)
+		}
+		for _, t := range r.Tags {
+			tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+		if r.NextToken == nil {
+			return tags, nil
+		}
+		params.NextToken = r.NextToken
+	}
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func orInt64(v, def int64) int64 {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultReadCapacity  = 10
+	defaultWriteCapacity = 5
+)
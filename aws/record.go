@@ -8,11 +8,14 @@ import (
 // AWS-RECORD
 
 // awsRecord stores a single entry in the lock table.
+// The attribute names come from the AwsSchema.
 type awsRecord struct {
-	Signature    string    `json:"lsig"`           // The ID for this lock. MUST MATCH awsSignatureKey
-	Signee       string    `json:"lsignee"`        // The owner requesting the lock. MUST MATCH awsSigneeKey
-	Level        int       `json:"llevel"`         // The level of lock requested. Leave this at the default 0 if you don't require levels. MUST MATCH awsLevelKey
-	ExpiresEpoch int64     `json:"lexpires"`       // The time at which this lock expires (epoch). MUST MATCH awsExpiresKey
-	Ttl          int64     `json:"lttl,omitempty"` // The TTL. Epoch seconds.
-	Expires      time.Time `json:"-"`              // The time at which this lock expires. Convenience for clients.
+	Signature    string    // The ID for this lock.
+	Signee       string    // The owner requesting the lock.
+	Level        int       // The level of lock requested. Leave this at the default 0 if you don't require levels.
+	ExpiresEpoch int64     // The time at which this lock expires (epoch).
+	Ttl          int64     // The TTL. Epoch seconds.
+	WrittenEpoch int64     // The writer's time when this record was written (epoch), for skew detection.
+	Expires      time.Time // The time at which this lock expires. Convenience for clients.
+	Namespace    string    // The namespace of this lock, if the schema has one.
 }
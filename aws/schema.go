@@ -0,0 +1,268 @@
+package lidaws
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// AWS-OPTS
+
+// AwsOpts provides the DynamoDB-specific options for the service.
+type AwsOpts struct {
+	// SkipCreate uses an existing table instead of creating it, so the
+	// service needs no CreateTable or UpdateTimeToLive permission. The
+	// table's schema is validated at construction either way.
+	SkipCreate bool
+	// Schema names the key and attributes of the lock table.
+	// Empty names use the defaults.
+	Schema AwsSchema
+
+	// The rest are applied when the table is created. When the table
+	// already exists, any that are set and differ are reported to OnDrift.
+
+	// BillingMode is PROVISIONED (the default) or PAY_PER_REQUEST.
+	BillingMode string
+	// ReadCapacity and WriteCapacity are the provisioned throughput.
+	// Defaults 10 and 5.
+	ReadCapacity  int64
+	WriteCapacity int64
+	// KmsKeyId, if set, encrypts the table with the KMS key. Compared
+	// against the end of the table's key ARN, so use the key id or ARN.
+	KmsKeyId string
+	// PointInTimeRecovery enables continuous backups.
+	PointInTimeRecovery bool
+	// StreamViewType, if set, enables the table's stream, i.e. NEW_AND_OLD_IMAGES.
+	StreamViewType string
+	// Tags are applied to the table.
+	Tags map[string]string
+	// OnDrift, if set, is called at construction with the settings of an
+	// existing table that differ from these options. It can't be set in a
+	// lid.Open URL; call TableDrift to check a table opened that way.
+	OnDrift func([]AwsDrift)
+}
+
+// ------------------------------------------------------------
+// AWS-SCHEMA
+
+// AwsSchema names the key and attributes of the lock table, so the
+// table can follow a single-table design shared with other data.
+type AwsSchema struct {
+	// Namespace, if set, is the partition key, a string, and Signature is
+	// the sort key. See Namespacer. There is no default.
+	Namespace  string
+	Signature  string // The partition key, a string. Default "lsig".
+	Signee     string // Default "lsignee".
+	Level      string // Default "llevel".
+	Expires    string // Default "lexpires".
+	TimeToLive string // The table's TTL attribute. Default "lttl".
+	Written    string // Default "lwritten".
+}
+
+// withDefaults() answers the schema with every empty name set to its default.
+func (s AwsSchema) withDefaults() AwsSchema {
+	def := func(name *string, value string) {
+		if *name == "" {
+			*name = value
+		}
+	}
+	def(&s.Signature, awsSignatureKey)
+	def(&s.Signee, awsSigneeKey)
+	def(&s.Level, awsLevelKey)
+	def(&s.Expires, awsExpiresKey)
+	def(&s.TimeToLive, ttlAttributeName)
+	def(&s.Written, awsWrittenKey)
+	return s
+}
+
+// names() adds the expression attribute names used by the builder's
+// condition. DynamoDB rejects a request with unused names.
+func (s AwsSchema) names(b awsBuilder) awsBuilder {
+	names := []struct{ placeholder, name string }{
+		{"#sig", s.Signature},
+		{"#se", s.Signee},
+		{"#lv", s.Level},
+		{"#ex", s.Expires},
+	}
+	for _, n := range names {
+		if strings.Contains(b.condition, n.placeholder) {
+			b = b.name(n.placeholder, n.name)
+		}
+	}
+	return b
+}
+
+// item() answers the table item for the record.
+func (s AwsSchema) item(r awsRecord) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		s.Signature: {S: aws.String(r.Signature)},
+		s.Signee:    {S: aws.String(r.Signee)},
+		s.Level:     {N: aws.String(strconv.Itoa(r.Level))},
+		s.Expires:   {N: aws.String(strconv.FormatInt(r.ExpiresEpoch, 10))},
+	}
+	if r.Ttl != 0 {
+		item[s.TimeToLive] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(r.Ttl, 10))}
+	}
+	if r.WrittenEpoch != 0 {
+		item[s.Written] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(r.WrittenEpoch, 10))}
+	}
+	if s.Namespace != "" {
+		item[s.Namespace] = &dynamodb.AttributeValue{S: aws.String(r.Namespace)}
+	}
+	return item
+}
+
+// record() answers the record in the table item. Missing attributes are left empty.
+func (s AwsSchema) record(item map[string]*dynamodb.AttributeValue) (awsRecord, error) {
+	r := awsRecord{}
+	fields := []struct {
+		name string
+		dst  interface{}
+	}{
+		{s.Signature, &r.Signature},
+		{s.Signee, &r.Signee},
+		{s.Level, &r.Level},
+		{s.Expires, &r.ExpiresEpoch},
+		{s.TimeToLive, &r.Ttl},
+		{s.Written, &r.WrittenEpoch},
+		{s.Namespace, &r.Namespace},
+	}
+	for _, f := range fields {
+		if v, ok := item[f.name]; ok && f.name != "" {
+			if err := dynamodbattribute.Unmarshal(v, f.dst); err != nil {
+				return awsRecord{}, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// keys() answers the key schema of the table.
+func (s AwsSchema) keys() []*dynamodb.KeySchemaElement {
+	if s.Namespace == "" {
+		return []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(s.Signature), KeyType: aws.String("HASH")},
+		}
+	}
+	return []*dynamodb.KeySchemaElement{
+		{AttributeName: aws.String(s.Namespace), KeyType: aws.String("HASH")},
+		{AttributeName: aws.String(s.Signature), KeyType: aws.String("RANGE")},
+	}
+}
+
+// attributes() answers the definitions of the key attributes.
+func (s AwsSchema) attributes() []*dynamodb.AttributeDefinition {
+	var atts []*dynamodb.AttributeDefinition
+	for _, k := range s.keys() {
+		atts = append(atts, &dynamodb.AttributeDefinition{AttributeName: k.AttributeName, AttributeType: aws.String("S")})
+	}
+	return atts
+}
+
+// validate() answers an error if the table can't hold my records.
+func (s AwsSchema) validate(table *dynamodb.TableDescription) error {
+	keys := s.keys()
+	if table == nil || len(table.KeySchema) != len(keys) {
+		return errSchemaMismatch
+	}
+	for i, key := range keys {
+		have := table.KeySchema[i]
+		if aws.StringValue(have.KeyType) != *key.KeyType || aws.StringValue(have.AttributeName) != *key.AttributeName {
+			return errSchemaMismatch
+		}
+		if attributeType(table, *key.AttributeName) != "S" {
+			return errSchemaMismatch
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// attributeType() answers the type of the named attribute definition.
+func attributeType(table *dynamodb.TableDescription, name string) string {
+	for _, att := range table.AttributeDefinitions {
+		if aws.StringValue(att.AttributeName) == name {
+			return aws.StringValue(att.AttributeType)
+		}
+	}
+	return ""
+}
+
+// parseAwsOpts() answers the AwsOpts in the registry query parameters.
+func parseAwsOpts(q url.Values) (AwsOpts, error) {
+	opts := AwsOpts{}
+	if v := q.Get(skipCreateParam); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidSkipCreate
+		}
+		opts.SkipCreate = skip
+	}
+	opts.BillingMode = q.Get("billing_mode")
+	opts.KmsKeyId = q.Get("kms_key")
+	opts.StreamViewType = q.Get("stream_view")
+	var err error
+	opts.ReadCapacity, err = parseInt64Param(q, "read_capacity", err)
+	opts.WriteCapacity, err = parseInt64Param(q, "write_capacity", err)
+	if err != nil {
+		return opts, err
+	}
+	if v := q.Get(pitrParam); v != "" {
+		pitr, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errInvalidPitr
+		}
+		opts.PointInTimeRecovery = pitr
+	}
+	for k, v := range q {
+		if !strings.HasPrefix(k, tagParamPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(k, tagParamPrefix)
+		if key == "" || len(v) != 1 {
+			return opts, errInvalidTag
+		}
+		if opts.Tags == nil {
+			opts.Tags = make(map[string]string)
+		}
+		opts.Tags[key] = v[0]
+	}
+	opts.Schema = AwsSchema{
+		Namespace:  q.Get("namespace_attr"),
+		Signature:  q.Get("signature_attr"),
+		Signee:     q.Get("signee_attr"),
+		Level:      q.Get("level_attr"),
+		Expires:    q.Get("expires_attr"),
+		TimeToLive: q.Get("ttl_attr"),
+		Written:    q.Get("written_attr"),
+	}
+	return opts, nil
+}
+
+func parseInt64Param(q url.Values, name string, err error) (int64, error) {
+	v := q.Get(name)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || i < 0 {
+		return 0, errors.New("Bad request: Invalid " + name + " (" + v + ")")
+	}
+	return i, nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	pitrParam       = "pitr"
+	skipCreateParam = "skip_create"
+	tagParamPrefix  = "tag."
+)
@@ -1,12 +1,14 @@
 package lidaws
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/hackborn/lid"
+	"net/url"
 	"time"
 )
 
@@ -17,17 +19,67 @@ import (
 // This is basically the point of this package, so it's the
 // one and only service.
 type awsService struct {
-	db   *dynamodb.DynamoDB
-	opts lid.ServiceOpts
+	db        *dynamodb.DynamoDB
+	opts      lid.ServiceOpts
+	aopts     AwsOpts
+	schema    AwsSchema
+	namespace string // The value of the namespace key, if the schema has one.
+	skew      *skewDetector
+}
+
+// init() registers the "dynamodb" backend, i.e.
+// dynamodb://table?region=us-west-2&endpoint=http://localhost:8000&duration=30s
+// An existing table is used with skip_create=true, and the schema's
+// names with signature_attr, signee_attr, level_attr, expires_attr,
+// ttl_attr, written_attr and namespace_attr, with namespace naming the
+// Namespacer view to answer. A new table is provisioned with billing_mode,
+// read_capacity, write_capacity, kms_key, pitr, stream_view and a
+// tag.<key>=<value> for each tag. AwsOpts.OnDrift has no parameter.
+func init() {
+	lid.Register("dynamodb", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		if u.Host != "" {
+			opts.Table = u.Host
+		}
+		cfg := &aws.Config{}
+		q := u.Query()
+		if region := q.Get("region"); region != "" {
+			cfg = cfg.WithRegion(region)
+		}
+		if endpoint := q.Get("endpoint"); endpoint != "" {
+			cfg = cfg.WithEndpoint(endpoint)
+		}
+		aopts, err := parseAwsOpts(q)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := session.NewSession(cfg)
+		if err != nil {
+			return nil, err
+		}
+		s, err := _newAwsServiceFromSession(opts, aopts, sess)
+		if err != nil {
+			return nil, err
+		}
+		if namespace := q.Get("namespace"); namespace != "" {
+			return s.Namespace(namespace)
+		}
+		return s, nil
+	})
 }
 
 // NewAwsServiceFromSession constructs a new service based on the provide AWS session.
 // I will internally manage my own connection to a DynamoDB client.
 func NewAwsServiceFromSession(opts lid.ServiceOpts, sess *session.Session) (lid.Service, error) {
-	return _newAwsServiceFromSession(opts, sess)
+	return _newAwsServiceFromSession(opts, AwsOpts{}, sess)
 }
 
-func _newAwsServiceFromSession(opts lid.ServiceOpts, sess *session.Session) (*awsService, error) {
+// NewAwsServiceWithOpts constructs a new service based on the provided AWS session,
+// with the DynamoDB-specific options.
+func NewAwsServiceWithOpts(opts lid.ServiceOpts, aopts AwsOpts, sess *session.Session) (lid.Service, error) {
+	return _newAwsServiceFromSession(opts, aopts, sess)
+}
+
+func _newAwsServiceFromSession(opts lid.ServiceOpts, aopts AwsOpts, sess *session.Session) (*awsService, error) {
 	if sess == nil {
 		return nil, errSessionRequired
 	}
@@ -41,9 +93,17 @@ func _newAwsServiceFromSession(opts lid.ServiceOpts, sess *session.Session) (*aw
 	if db == nil {
 		return nil, errDynamoRequired
 	}
-	s := &awsService{db: db, opts: opts}
+	s := &awsService{db: db, opts: opts, aopts: aopts, schema: aopts.Schema.withDefaults(), namespace: defaultNamespace, skew: newSkewDetector(opts)}
+	if s.skew != nil {
+		db.Handlers.Complete.PushBack(s.skew.observeResponse(func() time.Time { return s.opts.Now() }))
+	}
 	// Make sure the table has been constructed
-	err := s.createTable()
+	var err error
+	if aopts.SkipCreate {
+		err = s.validateTable()
+	} else {
+		err = s.createTable()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -54,20 +114,33 @@ func (s *awsService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResp
 	if !req.IsValid() {
 		return lid.LockResponse{}, lid.ErrBadRequest
 	}
-	now := time.Now()
+	now := s.opts.Now()
+	if err := s.skew.check(now); err != nil {
+		// Observe the record anyway, so I notice when the skew is gone.
+		s.observeItem(lockContext(opts), req.Signature)
+		now = s.opts.Now()
+		if err = s.skew.check(now); err != nil {
+			return lid.LockResponse{}, err
+		}
+	}
 	endTime := now.Add(s.opts.Duration)
-	record := awsRecord{req.Signature, req.Signee, req.Level, endTime.UnixNano(), s.getTtl(opts), endTime}
+	record := awsRecord{req.Signature, req.Signee, req.Level, endTime.UnixNano(), s.getTtl(now, opts), now.UnixNano(), endTime, s.namespace}
 
-	// Acquire the lock. See Service.Lock() for the rules.
-	b := awsBuilder{condition: awsAcquireLockCond}
-	b = b.value(":se", req.Signee).value(":lv", req.Level).value(":ex", now.UnixNano())
+	// Acquire the lock. See Service.Lock() for the rules. The expiry is
+	// compared against a time widened by the skew tolerance, so a host with
+	// a fast clock can't take a lock that is still valid for its owner.
+	expired := now.Add(-s.opts.ClockSkewTolerance)
+	b := s.schema.names(awsBuilder{condition: awsAcquireLockCond})
+	b = b.value(":se", req.Signee).value(":lv", req.Level).value(":ex", expired.UnixNano())
 	if b.err != nil {
 		return lid.LockResponse{}, b.err
 	}
 
-	ls, err := s.putItem(record, b)
+	ls, err := s.putItem(lockContext(opts), record, b)
+	s.skew.observe(ls, now)
 	if err != nil {
 		if err == errConditionFailed {
+			s.observeItem(lockContext(opts), req.Signature)
 			return lid.LockResponse{}, lid.ErrForbidden
 		}
 		return lid.LockResponse{}, err
@@ -84,13 +157,13 @@ func (s *awsService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResp
 	return resp, err
 }
 
-func (s *awsService) getTtl(opts *lid.LockOpts) int64 {
+func (s *awsService) getTtl(now time.Time, opts *lid.LockOpts) int64 {
 	ttl := s.opts.TimeToLive
 	if opts != nil && opts.TimeToLive != emptyTtl {
 		ttl = opts.TimeToLive
 	}
 	if ttl != emptyTtl {
-		return time.Now().Add(ttl).Unix()
+		return now.Add(ttl).Unix()
 	}
 	return 0
 }
@@ -101,15 +174,17 @@ func (s *awsService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.Un
 	}
 
 	// Release the lock. See Service.Unlock() for the rules.
-	b := awsBuilder{condition: awsReleaseLockCond}
-	b = b.key(awsSignatureKey, req.Signature).value(":se", req.Signee)
+	b := s.schema.names(awsBuilder{condition: awsReleaseLockCond})
+	b = s.key(b, req.Signature).value(":se", req.Signee)
 	if b.err != nil {
 		return lid.UnlockResponse{}, b.err
 	}
 
-	ls, err := s.deleteItem(b)
+	ls, err := s.deleteItem(unlockContext(opts), b)
+	s.skew.observe(ls, s.opts.Now())
 	if err != nil {
 		if err == errConditionFailed {
+			s.observeItem(unlockContext(opts), req.Signature)
 			return lid.UnlockResponse{}, lid.ErrForbidden
 		}
 		return lid.UnlockResponse{}, err
@@ -125,38 +200,63 @@ func (s *awsService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.Un
 // if the lock doesn't exist.
 // DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
 // I transition a service to this library.
+// Check takes no context, so its GetItem has no parent span to join
+// and isn't traced.
 func (s *awsService) Check(signature string) (lid.CheckResponse, error) {
 	if signature == "" {
 		return lid.CheckResponse{}, lid.ErrBadRequest
 	}
-	b := awsBuilder{}
-	b = b.key(awsSignatureKey, signature)
+	b := s.key(awsBuilder{}, signature)
 	if b.err != nil {
 		return lid.CheckResponse{}, b.err
 	}
-	r, err := s.getItem(b)
+	r, err := s.getItem(context.Background(), b)
+	s.skew.observe(r, s.opts.Now())
 	if err == nil && r.Signee != "" {
 		return lid.CheckResponse{r.Signee, r.Level}, nil
 	}
+	if lid.IsTransient(err) {
+		return lid.CheckResponse{}, err
+	}
 	return lid.CheckResponse{}, lid.ErrNotFound
 }
 
-// getItem() is a convenience wrapper for DynamoDB's PutItem().
-func (s *awsService) getItem(b awsBuilder) (awsRecord, error) {
+// observeItem() reads the signature's record for the skew detector. A
+// failed conditional write answers no record, and the pinned SDK has no
+// ReturnValuesOnConditionCheckFailure, so this is how I see the record
+// that refused me.
+func (s *awsService) observeItem(ctx context.Context, signature string) {
+	if s.skew == nil {
+		return
+	}
+	b := s.key(awsBuilder{}, signature)
+	if b.err != nil {
+		return
+	}
+	r, _ := s.getItem(ctx, b)
+	s.skew.observe(r, s.opts.Now())
+}
+
+// getItem() is a convenience wrapper for DynamoDB's GetItem().
+func (s *awsService) getItem(ctx context.Context, b awsBuilder) (awsRecord, error) {
 	if s.db == nil {
 		return awsRecord{}, errInitializationFailed
 	}
+	// Consistent, so a Check after a failed write sees what it did.
 	params := &dynamodb.GetItemInput{
-		TableName: aws.String(s.opts.Table),
+		TableName:      aws.String(s.opts.Table),
+		ConsistentRead: aws.Bool(true),
 	}
 	b.get(params)
-	r, err := s.db.GetItem(params)
+	span := s.startSpan(ctx, "GetItem")
+	defer span.End()
+	r, err := s.db.GetItemWithContext(awsContext(ctx), params)
 	if err != nil {
-		return awsRecord{}, err
+		span.SetError(err)
+		return awsRecord{}, s.requestErr("GetItem", err)
 	}
 	if len(r.Item) > 0 {
-		record := awsRecord{}
-		err = dynamodbattribute.UnmarshalMap(r.Item, &record)
+		record, err := s.schema.record(r.Item)
 		if err == nil {
 			return record, nil
 		}
@@ -165,32 +265,30 @@ func (s *awsService) getItem(b awsBuilder) (awsRecord, error) {
 }
 
 // putItem is a convenience wrapper for DynamoDB's PutItem().
-func (s *awsService) putItem(item interface{}, b awsBuilder) (awsRecord, error) {
+func (s *awsService) putItem(ctx context.Context, item awsRecord, b awsBuilder) (awsRecord, error) {
 	if s.db == nil {
 		return awsRecord{}, errInitializationFailed
 	}
-	atts, err := dynamodbattribute.MarshalMap(item)
-	if err != nil {
-		return awsRecord{}, err
-	}
 	params := &dynamodb.PutItemInput{
 		TableName:    aws.String(s.opts.Table),
-		Item:         atts,
+		Item:         s.schema.item(item),
 		ReturnValues: aws.String("ALL_OLD"),
 	}
 	b.put(params)
-	resp, err := s.db.PutItem(params)
+	span := s.startSpan(ctx, "PutItem")
+	defer span.End()
+	resp, err := s.db.PutItemWithContext(awsContext(ctx), params)
 	if err != nil {
+		span.SetError(err)
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
 			return awsRecord{}, errConditionFailed
 		}
-		return awsRecord{}, err
+		return awsRecord{}, s.requestErr("PutItem", err)
 	}
 	if len(resp.Attributes) < 1 {
 		return awsRecord{}, nil
 	}
-	record := awsRecord{}
-	err = dynamodbattribute.UnmarshalMap(resp.Attributes, &record)
+	record, err := s.schema.record(resp.Attributes)
 	if err == nil && record.ExpiresEpoch != 0 {
 		record.Expires = time.Unix(0, record.ExpiresEpoch)
 	}
@@ -198,7 +296,7 @@ func (s *awsService) putItem(item interface{}, b awsBuilder) (awsRecord, error)
 }
 
 // deleteItem is a convenience wrapper for DynamoDB's DeleteItem().
-func (s *awsService) deleteItem(b awsBuilder) (awsRecord, error) {
+func (s *awsService) deleteItem(ctx context.Context, b awsBuilder) (awsRecord, error) {
 	if s.db == nil {
 		return awsRecord{}, errInitializationFailed
 	}
@@ -207,35 +305,108 @@ func (s *awsService) deleteItem(b awsBuilder) (awsRecord, error) {
 		ReturnValues: aws.String("ALL_OLD"),
 	}
 	b.delete(params)
-	resp, err := s.db.DeleteItem(params)
+	span := s.startSpan(ctx, "DeleteItem")
+	defer span.End()
+	resp, err := s.db.DeleteItemWithContext(awsContext(ctx), params)
 	if err != nil {
+		span.SetError(err)
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
 			return awsRecord{}, errConditionFailed
 		}
-		return awsRecord{}, err
+		return awsRecord{}, s.requestErr("DeleteItem", err)
 	}
 	if len(resp.Attributes) < 1 {
 		return awsRecord{}, nil
 	}
-	record := awsRecord{}
-	err = dynamodbattribute.UnmarshalMap(resp.Attributes, &record)
-	return record, err
+	return s.schema.record(resp.Attributes)
+}
+
+// startSpan() answers a child span of ctx for a DynamoDB request.
+func (s *awsService) startSpan(ctx context.Context, operation string) lid.Span {
+	span := lid.StartSpan(ctx, "dynamodb."+operation)
+	span.SetAttribute("db.system", "dynamodb")
+	span.SetAttribute("db.operation", operation)
+	span.SetAttribute("db.table", s.opts.Table)
+	return span
+}
+
+// requestErr() answers a PermissionError if the credentials aren't
+// allowed to make the request, otherwise the transientErr().
+func (s *awsService) requestErr(operation string, err error) error {
+	if isAwsErrorCode(err, awsAccessDenied) {
+		return &PermissionError{Action: "dynamodb:" + operation, Table: s.opts.Table, Err: err}
+	}
+	return transientErr(err)
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// transientErr() wraps errors that may succeed if retried, such as
+// throttling, exceeded throughput, server errors and network failures,
+// so clients can tell them from a real failure with lid.IsTransient().
+func transientErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if request.IsErrorThrottle(err) {
+		return lid.NewTransientError(err)
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() >= 500 {
+		return lid.NewTransientError(err)
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		if aerr.Code() == request.CanceledErrorCode || request.IsErrorExpiredCreds(err) {
+			return err
+		}
+	}
+	if request.IsErrorRetryable(err) {
+		return lid.NewTransientError(err)
+	}
+	return err
+}
+
+func lockContext(opts *lid.LockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+func unlockContext(opts *lid.UnlockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+// awsContext() answers ctx, or the background context if ctx is nil.
+func awsContext(ctx context.Context) aws.Context {
+	if ctx == nil {
+		return aws.BackgroundContext()
+	}
+	return ctx
 }
 
 // ------------------------------------------------------------
 // CONST and VAR
 
+// The default attribute names.
 const (
 	awsSignatureKey = "lsig"
 	awsSigneeKey    = "lsignee"
 	awsLevelKey     = "llevel"
 	awsExpiresKey   = "lexpires"
+	awsWrittenKey   = "lwritten"
+
+	awsAccessDenied = "AccessDeniedException"
 )
 
 var (
 	awsEmptyDuration = time.Second * 0
 	emptyTtl         time.Duration
 
-	awsAcquireLockCond = `attribute_not_exists(` + awsSignatureKey + `) OR ` + awsSigneeKey + ` = :se OR ` + awsLevelKey + ` < :lv OR ` + awsExpiresKey + ` < :ex`
-	awsReleaseLockCond = `attribute_not_exists(` + awsSignatureKey + `) OR ` + awsSigneeKey + ` = :se`
+	// The conditions name the attributes with AwsSchema.names().
+	awsAcquireLockCond = `attribute_not_exists(#sig) OR #se = :se OR #lv < :lv OR #ex < :ex`
+	awsReleaseLockCond = `attribute_not_exists(#sig) OR #se = :se`
 )
@@ -0,0 +1,141 @@
+package lidaws
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/hackborn/lid"
+	"github.com/micro-go/lock"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// SKEW-DETECTOR
+
+// skewDetector compares this host's clock with other clocks, and
+// reports the largest recent offset in either direction.
+//
+// A record written in the future is certain evidence that the writer's
+// clock is ahead of mine. A record written in the past proves nothing,
+// so it's ignored. The Date header of every DynamoDB response measures
+// the server's clock, which also catches my own clock running ahead; the
+// latest response replaces the previous measurement. Record samples expire
+// after skewSampleAge, so a recovered clock stops being reported.
+type skewDetector struct {
+	tolerance time.Duration
+	fn        lid.ClockSkewFunc
+
+	mutex   sync.Mutex
+	server  skewSample
+	samples [skewSampleSize]skewSample
+	next    int
+}
+
+// skewSample is one measurement of another clock.
+type skewSample struct {
+	offset time.Duration // How far the other clock is ahead of mine. Negative if behind.
+	at     time.Time     // When I took the sample, by my clock.
+}
+
+func newSkewDetector(opts lid.ServiceOpts) *skewDetector {
+	if opts.OnClockSkew == nil {
+		return nil
+	}
+	return &skewDetector{tolerance: opts.ClockSkewTolerance, fn: opts.OnClockSkew}
+}
+
+// observe() records how far a record's write time is ahead of now.
+func (d *skewDetector) observe(record awsRecord, now time.Time) {
+	if d == nil || record.WrittenEpoch == 0 {
+		return
+	}
+	if offset := time.Unix(0, record.WrittenEpoch).Sub(now); offset > 0 {
+		d.add(skewSample{offset, now})
+	}
+}
+
+// observeServer() records the offset of the server's clock from a
+// response Date, which has a resolution of one second. The server
+// stamped the Date between sent and received, so I only count the
+// offset that can't be explained by the resolution and the latency.
+func (d *skewDetector) observeServer(date, sent, received time.Time) {
+	if d == nil {
+		return
+	}
+	var offset time.Duration
+	switch latest := date.Add(time.Second); {
+	case date.After(received):
+		offset = date.Sub(received)
+	case sent.After(latest):
+		offset = latest.Sub(sent)
+	}
+	defer lock.Locker(&d.mutex).Unlock()
+	d.server = skewSample{offset, received}
+}
+
+// observeResponse() is a DynamoDB request handler that observes the Date
+// of every response. now is the service clock.
+func (d *skewDetector) observeResponse(now func() time.Time) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.HTTPResponse == nil || r.AttemptTime.IsZero() {
+			return
+		}
+		date, err := http.ParseTime(r.HTTPResponse.Header.Get("Date"))
+		if err != nil {
+			return
+		}
+		received := now()
+		d.observeServer(date, received.Add(-time.Since(r.AttemptTime)), received)
+	}
+}
+
+func (d *skewDetector) add(sample skewSample) {
+	defer lock.Locker(&d.mutex).Unlock()
+	d.samples[d.next] = sample
+	d.next = (d.next + 1) % skewSampleSize
+}
+
+// skew() answers the recent offset furthest from zero.
+func (d *skewDetector) skew(now time.Time) time.Duration {
+	defer lock.Locker(&d.mutex).Unlock()
+	var skew time.Duration
+	for _, s := range append(d.samples[:], d.server) {
+		if s.at.IsZero() || now.Sub(s.at) > skewSampleAge {
+			continue
+		}
+		if abs(s.offset) > abs(skew) {
+			skew = s.offset
+		}
+	}
+	return skew
+}
+
+// check() answers the ClockSkewFunc's response if the skew
+// is beyond the tolerance.
+func (d *skewDetector) check(now time.Time) error {
+	if d == nil {
+		return nil
+	}
+	if skew := d.skew(now); abs(skew) > d.tolerance {
+		return d.fn(skew)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	skewSampleSize = 16
+	skewSampleAge  = time.Minute
+)
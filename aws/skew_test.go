@@ -0,0 +1,99 @@
+package lidaws
+
+import (
+	"github.com/hackborn/lid"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSkewDetector verifies that records written in the future and
+// server clocks beyond the tolerance, in either direction, are reported.
+func TestSkewDetector(t *testing.T) {
+	now := time.Now()
+	type server struct {
+		Date, Sent time.Duration // Relative to now, which is when the response was received.
+	}
+	cases := []struct {
+		Written []time.Duration // Record write times, relative to now
+		Server  *server
+		Want    time.Duration
+	}{
+		{nil, nil, 0},
+		{[]time.Duration{-time.Minute, -time.Second}, nil, 0},
+		{[]time.Duration{time.Second}, nil, 0},
+		{[]time.Duration{-time.Minute, 3 * time.Second, -time.Second}, nil, 3 * time.Second},
+		// The server agrees within its resolution and my latency.
+		{nil, &server{-time.Second, -10 * time.Millisecond}, 0},
+		// The server is ahead of me.
+		{nil, &server{5 * time.Second, -10 * time.Millisecond}, 5 * time.Second},
+		// I'm ahead of the server, which no record can show.
+		{nil, &server{-5 * time.Second, -10 * time.Millisecond}, -3990 * time.Millisecond},
+		{[]time.Duration{3 * time.Second}, &server{-5 * time.Second, 0}, -4 * time.Second},
+	}
+	for i, tc := range cases {
+		var have time.Duration
+		opts := lid.ServiceOpts{ClockSkewTolerance: 2 * time.Second, OnClockSkew: func(skew time.Duration) error {
+			have = skew
+			return lid.ErrClockSkew
+		}}
+		d := newSkewDetector(opts)
+		for _, w := range tc.Written {
+			d.observe(awsRecord{WrittenEpoch: now.Add(w).UnixNano()}, now)
+		}
+		if tc.Server != nil {
+			d.observeServer(now.Add(tc.Server.Date), now.Add(tc.Server.Sent), now)
+		}
+		err := d.check(now)
+		if have != tc.Want || (err != nil) != (tc.Want != 0) {
+			t.Fatal("case", i, "have", have, err, "want", tc.Want)
+		}
+	}
+
+	// Samples expire, and the latest server measurement replaces the last.
+	d := newSkewDetector(lid.ServiceOpts{ClockSkewTolerance: time.Second, OnClockSkew: lid.RefuseClockSkew})
+	d.observe(awsRecord{WrittenEpoch: now.Add(time.Hour).UnixNano()}, now)
+	d.observeServer(now.Add(-time.Hour), now, now)
+	if err := d.check(now); err != lid.ErrClockSkew {
+		t.Fatal("unexpected", err)
+	}
+	later := now.Add(skewSampleAge + time.Second)
+	d.observeServer(later, later, later)
+	if err := d.check(later); err != nil {
+		t.Fatal("unexpected", err)
+	}
+
+	// Without a ClockSkewFunc there is no detector, and nothing is refused.
+	d = newSkewDetector(lid.ServiceOpts{})
+	d.observe(awsRecord{WrittenEpoch: now.Add(time.Hour).UnixNano()}, now)
+	if err := d.check(now); err != nil {
+		t.Fatal("unexpected", err)
+	}
+}
+
+// TestSkewRecovery verifies a host whose clock is ahead of DynamoDB's is
+// refused, and that a refused lock still observes, so the host is
+// allowed again once its clock recovers.
+func TestSkewRecovery(t *testing.T) {
+	var offset int64 // The server clock's offset from mine.
+	srv := newFakeTable(func() time.Time {
+		return time.Now().Add(time.Duration(atomic.LoadInt64(&offset)))
+	})
+	defer srv.Close()
+	opts := lid.ServiceOpts{Table: "locks", Duration: time.Second * 10, ClockSkewTolerance: 2 * time.Second, OnClockSkew: lid.RefuseClockSkew}
+	s := newFakeTableService(srv, opts)
+
+	req := lid.LockRequest{Signature: "a", Signee: "0"}
+	_, err := s.Lock(req, nil)
+	lid.MustErr(err)
+	atomic.StoreInt64(&offset, int64(-10*time.Second))
+	// The first lock measures the skew, the next is refused.
+	s.Lock(req, nil)
+	if _, err = s.Lock(req, nil); err != lid.ErrClockSkew {
+		t.Fatal("skewed lock has", err)
+	}
+	atomic.StoreInt64(&offset, 0)
+	if _, err = s.Lock(req, nil); err != nil {
+		t.Fatal("recovered lock has", err)
+	}
+}
@@ -17,43 +17,16 @@ func (s *awsService) createTable() error {
 	if s.opts.Table == "" {
 		return errTableRequired
 	}
-	// Define table
-	partitiontype := "S"
-	att1 := &dynamodb.AttributeDefinition{
-		AttributeName: aws.String(awsSignatureKey),
-		AttributeType: aws.String(partitiontype),
-	}
-	/*
-		ttltype := "N"
-		att2 := &dynamodb.AttributeDefinition{
-			AttributeName: aws.String(ttlAttributeName),
-			AttributeType: aws.String(ttltype),
-		}
-	*/
-	key := &dynamodb.KeySchemaElement{
-		AttributeName: aws.String(awsSignatureKey),
-		KeyType:       aws.String("HASH"),
-	}
-	params := &dynamodb.CreateTableInput{
-		TableName:            aws.String(s.opts.Table),
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{att1},
-		KeySchema:            []*dynamodb.KeySchemaElement{key},
-		// Throughput doesn't really matter. Just about everyone should be using
-		// autoscaling, which you have to set manually.
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(10),
-			WriteCapacityUnits: aws.Int64(5),
-		},
-	}
+	params := s.createTableParams()
 
 	// Create table
 	_, err := s.db.CreateTable(params)
 	if err != nil {
 		// Indicates the table already exists.
 		if isAwsErrorCode(err, dynamodb.ErrCodeResourceInUseException) {
-			return nil
+			return s.validateTable()
 		}
-		return err
+		return s.requestErr("CreateTable", err)
 	}
 
 	// Wait for table to be ready
@@ -64,6 +37,10 @@ func (s *awsService) createTable() error {
 	if err != nil {
 		return err
 	}
+	err = s.enableBackups()
+	if err != nil {
+		return err
+	}
 
 	// Enable time to live
 	var emptyDur time.Duration
@@ -71,18 +48,57 @@ func (s *awsService) createTable() error {
 		ttlparams := &dynamodb.UpdateTimeToLiveInput{
 			TableName: aws.String(s.opts.Table),
 			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
-				AttributeName: aws.String(ttlAttributeName),
+				AttributeName: aws.String(s.schema.TimeToLive),
 				Enabled:       aws.Bool(true),
 			},
 		}
 		_, err = s.db.UpdateTimeToLive(ttlparams)
 		// This is returned by dynalite, all we can do is eat it to prevent
 		// incompatibilities.
-		if strings.HasPrefix(err.Error(), "UnknownOperationException") {
+		if err != nil && strings.HasPrefix(err.Error(), "UnknownOperationException") {
 			err = nil
 		}
+		if err != nil {
+			return s.requestErr("UpdateTimeToLive", err)
+		}
+	}
+	return nil
+}
+
+// validateTable() answers an error if my table doesn't exist,
+// or doesn't match my schema, and reports any drift.
+func (s *awsService) validateTable() error {
+	table, err := s.describeTable()
+	if err != nil {
+		return err
+	}
+	err = s.schema.validate(table)
+	if err != nil || s.aopts.OnDrift == nil {
+		return err
+	}
+	drift, err := s.drift(table)
+	if err != nil {
+		return err
+	}
+	if len(drift) > 0 {
+		s.aopts.OnDrift(drift)
+	}
+	return nil
+}
+
+// describeTable() answers the description of my table.
+func (s *awsService) describeTable() (*dynamodb.TableDescription, error) {
+	params := &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.opts.Table),
+	}
+	r, err := s.db.DescribeTable(params)
+	if err != nil {
+		if isAwsErrorCode(err, dynamodb.ErrCodeResourceNotFoundException) {
+			return nil, errTableMissing
+		}
+		return nil, s.requestErr("DescribeTable", err)
 	}
-	return err
+	return r.Table, nil
 }
 
 // deleteTable() deletes the table with the given name. Obviously this is an incredibly
@@ -109,10 +125,15 @@ func (s *awsService) deleteTable() {
 
 // tableStatus() answers the status of the requested table.
 func (s *awsService) tableStatus(name string) awsTableStatus {
+	return tableStatus(s.db, name)
+}
+
+// tableStatus() answers the status of the requested table.
+func tableStatus(db *dynamodb.DynamoDB, name string) awsTableStatus {
 	params := &dynamodb.DescribeTableInput{
 		TableName: aws.String(name),
 	}
-	r, err := s.db.DescribeTable(params)
+	r, err := db.DescribeTable(params)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
 			return awsMissing
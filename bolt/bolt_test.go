@@ -0,0 +1,124 @@
+package lidbolt
+
+import (
+	"github.com/hackborn/lid"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestReopen verifies locks survive closing and reopening the file.
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks.db")
+	opts := lid.ServiceOpts{Duration: time.Minute}
+	s, err := NewService(opts, path)
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0", Level: 2}, nil)
+	lid.MustErr(err)
+	lid.MustErr(s.Close())
+
+	s, err = NewService(opts, path)
+	lid.MustErr(err)
+	defer s.Close()
+	resp, err := s.Check("a")
+	if err != nil || resp.Signee != "0" || resp.Level != 2 {
+		t.Fatal("expected the lock to survive but have", resp, err)
+	}
+}
+
+// TestSweep verifies the sweep removes records that outlive their time to live.
+func TestSweep(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	opts := lid.ServiceOpts{Duration: time.Second * 10, Clock: clock}
+	s, err := _newService(opts, filepath.Join(t.TempDir(), "locks.db"), time.Hour)
+	lid.MustErr(err)
+	defer s.Close()
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Minute})
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Minute})
+	lid.MustErr(err)
+
+	clock.Advance(2 * time.Minute)
+	if _, err = s.Check("a"); err != lid.ErrNotFound {
+		t.Fatal("expected the lock to be gone but have", err)
+	}
+	lid.MustErr(s.sweep(clock.Now()))
+	if have := s.count(); have != 1 {
+		t.Fatal("expected one record after the sweep but have", have)
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	path := filepath.ToSlash(filepath.Join(t.TempDir(), "locks.db"))
+	s, err := lid.Open("bolt://" + path + "?duration=10s&table=locks")
+	lid.MustErr(err)
+	defer s.(Service).Close()
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if s.(*boltService).count() != 1 {
+		t.Fatal("expected the lock in the table")
+	}
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *boltService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *boltService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// count() answers the number of records in my bucket.
+func (s *boltService) count() int {
+	var n int
+	s.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(s.bucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type boltServiceBootstrap struct {
+	t       *testing.T
+	service *boltService
+}
+
+func (b *boltServiceBootstrap) OpenService() lid.Service {
+	opts := lid.ServiceOpts{Duration: time.Second * 10}
+	service, err := _newService(opts, filepath.Join(b.t.TempDir(), "locks.db"), defaultSweepInterval)
+	lid.MustErr(err)
+	b.service = service
+	return service
+}
+
+func (b *boltServiceBootstrap) CloseService() error {
+	return b.service.Close()
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &boltServiceBootstrap{t: t}
+	services = append(services, bootstrap)
+	return services
+}
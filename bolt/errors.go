@@ -0,0 +1,13 @@
+package lidbolt
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errPathRequired     = errors.New("Bad request: Path required")
+)
@@ -0,0 +1,291 @@
+package lidbolt
+
+import (
+	"encoding/json"
+	"github.com/hackborn/lid"
+	"go.etcd.io/bbolt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// SERVICE
+
+// Service is a lid.Service on a bbolt file. Close it to stop the
+// sweep and release the file.
+type Service interface {
+	lid.Service
+	io.Closer
+}
+
+// ------------------------------------------------------------
+// BOLT-SERVICE
+
+// boltService provides a lid.Service implementation on a bbolt file,
+// so lock state survives restarts of a single-node service. Every lock
+// decision is made inside a single write transaction.
+//
+// A record that has outlived its TimeToLive is treated as absent. A
+// background sweep removes those records so the file doesn't grow.
+type boltService struct {
+	opts   lid.ServiceOpts
+	db     *bbolt.DB
+	bucket []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+	swept     sync.WaitGroup
+}
+
+// init() registers the "bolt" backend, i.e. bolt:///var/lib/myapp/locks.db?duration=30s
+func init() {
+	lid.Register("bolt", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		return NewService(opts, u.Path)
+	})
+}
+
+// NewService constructs a new service on the bbolt file at path, creating
+// it if it doesn't exist. Locks are stored in the bucket named by the Table
+// option, or "lid" if empty.
+func NewService(opts lid.ServiceOpts, path string) (Service, error) {
+	return _newService(opts, path, defaultSweepInterval)
+}
+
+func _newService(opts lid.ServiceOpts, path string, sweepInterval time.Duration) (*boltService, error) {
+	if path == "" {
+		return nil, errPathRequired
+	}
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	bucket := opts.Table
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+	// Only one process can hold the file, so don't wait forever on another.
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &boltService{opts: opts, db: db, bucket: []byte(bucket), done: make(chan struct{})}
+	s.swept.Add(1)
+	go s.runSweep(sweepInterval)
+	return s, nil
+}
+
+func (s *boltService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	now := s.opts.Now()
+	resp := lid.LockResponse{Status: lid.LockOk}
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		key := []byte(req.Signature)
+		cur, ok, err := s.read(b, key, now)
+		if err != nil {
+			return err
+		}
+
+		// Acquire the lock. See Service.Lock() for the rules.
+		if ok {
+			expired := now.Add(-s.opts.ClockSkewTolerance).UnixNano()
+			if cur.Signee == req.Signee {
+				resp.Status = lid.LockRenewed
+			} else if cur.Level < req.Level || cur.Expires < expired {
+				resp = lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: cur.Signee}
+			} else {
+				resp = lid.LockResponse{Status: lid.LockFailed}
+				return lid.ErrForbidden
+			}
+		}
+
+		r := boltRecord{Signee: req.Signee, Level: req.Level, Expires: now.Add(s.getDuration(opts)).UnixNano()}
+		if ttl := s.getTtl(opts); ttl != emptyDuration {
+			r.Ttl = now.Add(ttl).UnixNano()
+		}
+		v, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, v)
+	})
+	if err == lid.ErrForbidden {
+		return resp, err
+	} else if err != nil {
+		return lid.LockResponse{}, err
+	}
+	return resp, nil
+}
+
+func (s *boltService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	now := s.opts.Now()
+	resp := lid.UnlockResponse{}
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		key := []byte(req.Signature)
+		cur, ok, err := s.read(b, key, now)
+		if err != nil {
+			return err
+		}
+
+		// Release the lock. See Service.Unlock() for the rules.
+		if !ok {
+			resp.Status = lid.UnlockNoLock
+			return nil
+		}
+		if cur.Signee != req.Signee {
+			return lid.ErrForbidden
+		}
+		resp.Status = lid.UnlockOk
+		return b.Delete(key)
+	})
+	if err != nil {
+		return lid.UnlockResponse{}, err
+	}
+	return resp, nil
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *boltService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	resp := lid.CheckResponse{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		cur, ok, err := s.read(tx.Bucket(s.bucket), []byte(signature), s.opts.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return lid.ErrNotFound
+		}
+		resp = lid.CheckResponse{Signee: cur.Signee, Level: cur.Level}
+		return nil
+	})
+	return resp, err
+}
+
+// Close() stops the sweep and closes the file.
+func (s *boltService) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.swept.Wait()
+		err = s.db.Close()
+	})
+	return err
+}
+
+// read() answers the record at key, and false if there is none
+// or it has outlived its time to live.
+func (s *boltService) read(b *bbolt.Bucket, key []byte, now time.Time) (boltRecord, bool, error) {
+	v := b.Get(key)
+	if v == nil {
+		return boltRecord{}, false, nil
+	}
+	r := boltRecord{}
+	err := json.Unmarshal(v, &r)
+	if err != nil {
+		return boltRecord{}, false, err
+	}
+	if r.expired(now) {
+		return boltRecord{}, false, nil
+	}
+	return r, true, nil
+}
+
+// runSweep() sweeps at every interval until I'm closed.
+func (s *boltService) runSweep(interval time.Duration) {
+	defer s.swept.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sweep(s.opts.Now())
+		}
+	}
+}
+
+// sweep() deletes every record that has outlived its time to live.
+func (s *boltService) sweep(now time.Time) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(s.bucket).Cursor()
+		for k, v := c.First(); k != nil; {
+			r := boltRecord{}
+			if json.Unmarshal(v, &r) == nil && r.expired(now) {
+				err := c.Delete()
+				if err != nil {
+					return err
+				}
+				// Deleting moves the cursor to the next item.
+				k, v = c.Seek(k)
+				continue
+			}
+			k, v = c.Next()
+		}
+		return nil
+	})
+}
+
+func (s *boltService) getDuration(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.Duration != emptyDuration {
+		return opts.Duration
+	}
+	return s.opts.Duration
+}
+
+func (s *boltService) getTtl(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.TimeToLive != emptyDuration {
+		return opts.TimeToLive
+	}
+	return s.opts.TimeToLive
+}
+
+// ------------------------------------------------------------
+// BOLT-RECORD
+
+// boltRecord stores a single lock.
+type boltRecord struct {
+	Signee  string `json:"signee"`
+	Level   int    `json:"level"`
+	Expires int64  `json:"expires"`       // The time at which this lock expires (epoch nanoseconds).
+	Ttl     int64  `json:"ttl,omitempty"` // The time at which this record is treated as deleted (epoch nanoseconds).
+}
+
+// expired() answers true if the record has outlived its time to live.
+func (r boltRecord) expired(now time.Time) bool {
+	return r.Ttl != 0 && r.Ttl < now.UnixNano()
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultBucket        = "lid"
+	defaultSweepInterval = time.Minute
+	openTimeout          = time.Second
+)
+
+var (
+	emptyDuration time.Duration
+)
@@ -0,0 +1,82 @@
+package lid
+
+import (
+	"github.com/micro-go/lock"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// CLOCK
+
+// Clock supplies the current time to services, for every expiry
+// and time to live calculation.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock that answers the real time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ------------------------------------------------------------
+// CLOCK-SKEW
+
+// ClockSkewFunc is notified when a service detects that this host's
+// clock differs from the clock of another host writing lock records
+// by more than the tolerance. Skew is how far the other clock is ahead;
+// it's negative when this host's clock is the one ahead.
+// Answer an error to refuse the operation, or nil to allow it.
+type ClockSkewFunc func(skew time.Duration) error
+
+// WarnClockSkew answers a ClockSkewFunc that logs the skew and
+// allows the operation.
+func WarnClockSkew(l Logger) ClockSkewFunc {
+	return func(skew time.Duration) error {
+		l.Printf("lid: clock skew of %v detected", skew)
+		return nil
+	}
+}
+
+// RefuseClockSkew is a ClockSkewFunc that refuses every operation
+// while skew is detected.
+func RefuseClockSkew(skew time.Duration) error {
+	return ErrClockSkew
+}
+
+// ------------------------------------------------------------
+// FAKE-CLOCK
+
+// FakeClock is a Clock that only moves when told to. It's
+// intended for testing expiry deterministically.
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFakeClock answers a new FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	defer lock.Locker(&c.mutex).Unlock()
+	return c.now
+}
+
+// Set moves the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	defer lock.Locker(&c.mutex).Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	defer lock.Locker(&c.mutex).Unlock()
+	c.now = c.now.Add(d)
+}
@@ -1,6 +1,7 @@
 package lid
 
 import (
+	"context"
 	"errors"
 )
 
@@ -18,6 +19,31 @@ func (e *Error) Error() string {
 	return e.Msg
 }
 
+// NewTransientError answers an Error wrapping a backend failure that
+// may succeed if retried, such as throttling or a network failure.
+func NewTransientError(err error) error {
+	return &Error{Transient, err.Error(), err}
+}
+
+// IsTransient answers true if err is a failure that may succeed if retried.
+// That is any Error with the Transient code, or any error (like most network
+// errors) that reports itself as temporary. A cancelled or expired context
+// never is, since the caller has given up.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *Error:
+		return e.Code == Transient
+	case interface{ Temporary() bool }:
+		return e.Temporary()
+	}
+	return false
+}
+
 // ------------------------------------------------------------
 // UTIL
 
@@ -46,6 +72,9 @@ func MustErr(err error) {
 const (
 	// Forbidden describes a lock that exists but is owned by another signee.
 	Forbidden = iota
+	// Transient describes a backend failure that may succeed if retried. The
+	// Payload is the original error.
+	Transient
 
 	forbiddenMsg = "Forbidden"
 )
@@ -53,5 +82,6 @@ const (
 var (
 	ErrForbidden  = &Error{Forbidden, forbiddenMsg, nil}
 	ErrBadRequest = errors.New("Bad request")
+	ErrClockSkew  = errors.New("Clock skew exceeds tolerance")
 	ErrNotFound   = errors.New("Not found")
 )
@@ -0,0 +1,15 @@
+package lidetcd
+
+import (
+	"errors"
+	"github.com/hackborn/lid"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errClientRequired   = errors.New("Client is required")
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errTooManyConflicts = lid.NewTransientError(errors.New("Too many conflicting writes"))
+)
@@ -0,0 +1,191 @@
+package lidetcd
+
+import (
+	"context"
+	"github.com/hackborn/lid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestTimeToLive verifies the time to live is applied as a lease.
+func TestTimeToLive(t *testing.T) {
+	client := startTestServer(t)
+	opts := lid.ServiceOpts{Duration: time.Second * 10, TimeToLive: time.Minute}
+	s, err := NewService(opts, client)
+	lid.MustErr(err)
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	resp, err := client.Get(context.Background(), "lid/a")
+	lid.MustErr(err)
+	if len(resp.Kvs) != 1 || resp.Kvs[0].Lease == 0 {
+		t.Fatal("expected the lock on a lease")
+	}
+	ttl, err := client.TimeToLive(context.Background(), clientv3.LeaseID(resp.Kvs[0].Lease))
+	lid.MustErr(err)
+	if ttl.GrantedTTL != 60 {
+		t.Fatal("expected a minute lease but have", ttl.GrantedTTL)
+	}
+}
+
+// TestLeases verifies a lock without a TimeToLive is on a lease, that
+// renewing keeps the lease, and that replaced and unlocked leases are revoked.
+func TestLeases(t *testing.T) {
+	client := startTestServer(t)
+	s, err := _newService(lid.ServiceOpts{Duration: time.Second * 10}, client)
+	lid.MustErr(err)
+	lease := func() (clientv3.LeaseID, int64) {
+		cur, _, err := s.get(context.Background(), "lid/a")
+		lid.MustErr(err)
+		ttl, err := client.TimeToLive(context.Background(), cur.Lease)
+		lid.MustErr(err)
+		return cur.Lease, ttl.GrantedTTL
+	}
+	leases := func() int {
+		resp, err := client.Leases(context.Background())
+		lid.MustErr(err)
+		return len(resp.Leases)
+	}
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	first, ttl := lease()
+	if first == clientv3.NoLease || ttl != 70 {
+		t.Fatal("have lease", first, "of", ttl, "want 70")
+	}
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1", Level: 1}, nil)
+	if have, _ := lease(); have != first || leases() != 1 {
+		t.Fatal("expected the lease kept but have", have, "of", leases())
+	}
+	// A different length needs a new lease.
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, &lid.LockOpts{TimeToLive: time.Hour})
+	if have, ttl := lease(); have == first || ttl != 3600 || leases() != 1 {
+		t.Fatal("expected a new lease but have", have, ttl, "of", leases())
+	}
+	// Racing first locks each grant a lease, and the losers revoke theirs.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Lock(lid.LockRequest{Signature: "b", Signee: strconv.Itoa(i)}, nil)
+		}(i)
+	}
+	wg.Wait()
+	if n := leases(); n != 2 {
+		t.Fatal("have", n, "leases after racing locks, want 2")
+	}
+	b, err := s.Check("b")
+	lid.MustErr(err)
+	_, err = s.Unlock(lid.UnlockRequest{Signature: "b", Signee: b.Signee}, nil)
+	lid.MustErr(err)
+	_, err = s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "1"}, nil)
+	lid.MustErr(err)
+	if n := leases(); n != 0 {
+		t.Fatal("have", n, "leases after unlock")
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	client := startTestServer(t)
+	s, err := lid.Open("etcd://" + client.Endpoints()[0][len("http://"):] + "?duration=10s&table=locks")
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	resp, err := client.Get(context.Background(), "locks/a")
+	lid.MustErr(err)
+	if len(resp.Kvs) != 1 {
+		t.Fatal("expected the lock in the table")
+	}
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *etcdService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *etcdService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type etcdServiceBootstrap struct {
+	client *clientv3.Client
+	count  int
+}
+
+func (b *etcdServiceBootstrap) OpenService() lid.Service {
+	// Each service gets its own keys, so the server can be shared.
+	b.count++
+	opts := lid.ServiceOpts{Duration: time.Second * 10, Table: "test" + strconv.Itoa(b.count)}
+	service, err := _newService(opts, b.client)
+	lid.MustErr(err)
+	return service
+}
+
+func (b *etcdServiceBootstrap) CloseService() error {
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &etcdServiceBootstrap{client: startTestServer(t)}
+	services = append(services, bootstrap)
+	return services
+}
+
+// startTestServer() starts an embedded etcd server, answering a
+// client connected to it. Both are closed when the test ends.
+func startTestServer(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	client, peer := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{client}, []url.URL{client}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peer}, []url.URL{peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	lid.MustErr(err)
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("etcd server took too long to start")
+	}
+
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{client.String()}, DialTimeout: 5 * time.Second})
+	lid.MustErr(err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// freeURL() answers a local URL on an unused port.
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	lid.MustErr(err)
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
@@ -0,0 +1,367 @@
+package lidetcd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hackborn/lid"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------
+// ETCD-SERVICE
+
+// etcdService provides a lid.Service implementation on etcd. Each
+// decision is made on a read of the lock, then committed with a
+// transaction that fails if the lock changed since the read.
+//
+// The expiry is stored in the record, so an expired lock still reports
+// its previous owner when taken. Every record is also attached to a lease,
+// and etcd deletes it when the lease ends. The lease covers the TimeToLive
+// if there is one, otherwise the Duration plus expiredRetention, and
+// always the Duration. A lock keeps its record's lease while it needs the
+// same length, so renewing doesn't grant a new one; a replaced lease, and
+// the lease of an unlocked record, are revoked.
+type etcdService struct {
+	client *clientv3.Client
+	opts   lid.ServiceOpts
+	prefix string
+}
+
+// init() registers the "etcd" backend, i.e.
+// etcd://localhost:2379?duration=30s&table=locks
+// Multiple endpoints are separated by commas in the host.
+func init() {
+	lid.Register("etcd", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		var endpoints []string
+		for _, h := range strings.Split(u.Host, ",") {
+			endpoints = append(endpoints, "http://"+h)
+		}
+		client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		return NewService(opts, client)
+	})
+}
+
+// NewService constructs a new service on the etcd client. Locks are
+// stored under keys prefixed with the Table option, or "lid" if empty.
+func NewService(opts lid.ServiceOpts, client *clientv3.Client) (lid.Service, error) {
+	return _newService(opts, client)
+}
+
+func _newService(opts lid.ServiceOpts, client *clientv3.Client) (*etcdService, error) {
+	if client == nil {
+		return nil, errClientRequired
+	}
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	prefix := opts.Table
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	return &etcdService{client: client, opts: opts, prefix: prefix + "/"}, nil
+}
+
+func (s *etcdService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	ctx := etcdContext(lockContext(opts))
+	key := s.key(req.Signature)
+	for i := 0; i < maxConflicts; i++ {
+		now := s.opts.Now()
+		cur, rev, err := s.get(ctx, key)
+		if err != nil {
+			return lid.LockResponse{}, err
+		}
+
+		// Acquire the lock. See Service.Lock() for the rules.
+		resp := lid.LockResponse{Status: lid.LockOk}
+		if rev != 0 {
+			expired := now.Add(-s.opts.ClockSkewTolerance).UnixNano()
+			if cur.Signee == req.Signee {
+				resp.Status = lid.LockRenewed
+			} else if cur.Level < req.Level || cur.Expires < expired {
+				resp = lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: cur.Signee}
+			} else {
+				return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
+			}
+		}
+
+		r := etcdRecord{Signee: req.Signee, Level: req.Level, Expires: now.Add(s.getDuration(opts)).UnixNano()}
+		r.Lease, r.LeaseTtl, err = s.lease(ctx, cur, opts)
+		if err != nil {
+			return lid.LockResponse{}, err
+		}
+		put, err := s.put(key, r)
+		if err != nil {
+			s.revoke(ctx, r.Lease, cur.Lease)
+			return lid.LockResponse{}, err
+		}
+		ok, err := s.commit(ctx, key, rev, put)
+		if err != nil {
+			// The commit may have applied, so its lease is left to end.
+			return lid.LockResponse{}, err
+		}
+		if ok {
+			s.revoke(ctx, cur.Lease, r.Lease)
+			return resp, nil
+		}
+		// Someone else changed the lock since I read it; decide again.
+		s.revoke(ctx, r.Lease, cur.Lease)
+	}
+	return lid.LockResponse{}, errTooManyConflicts
+}
+
+func (s *etcdService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	ctx := etcdContext(unlockContext(opts))
+	key := s.key(req.Signature)
+	for i := 0; i < maxConflicts; i++ {
+		cur, rev, err := s.get(ctx, key)
+		if err != nil {
+			return lid.UnlockResponse{}, err
+		}
+
+		// Release the lock. See Service.Unlock() for the rules.
+		if rev == 0 {
+			return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
+		}
+		if cur.Signee != req.Signee {
+			return lid.UnlockResponse{}, lid.ErrForbidden
+		}
+		ok, err := s.commit(ctx, key, rev, clientv3.OpDelete(key))
+		if err != nil {
+			return lid.UnlockResponse{}, err
+		}
+		if ok {
+			s.revoke(ctx, cur.Lease, 0)
+			return lid.UnlockResponse{Status: lid.UnlockOk}, nil
+		}
+	}
+	return lid.UnlockResponse{}, errTooManyConflicts
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *etcdService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	cur, rev, err := s.get(context.Background(), s.key(signature))
+	if err != nil {
+		return lid.CheckResponse{}, err
+	}
+	if rev == 0 {
+		return lid.CheckResponse{}, lid.ErrNotFound
+	}
+	return lid.CheckResponse{Signee: cur.Signee, Level: cur.Level}, nil
+}
+
+// get() answers the record at key and its mod revision, which is 0
+// if there is no record.
+func (s *etcdService) get(ctx context.Context, key string) (etcdRecord, int64, error) {
+	span := s.startSpan(ctx, "Get")
+	defer span.End()
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		span.SetError(err)
+		return etcdRecord{}, 0, transientErr(err)
+	}
+	if len(resp.Kvs) < 1 {
+		return etcdRecord{}, 0, nil
+	}
+	kv := resp.Kvs[0]
+	r := etcdRecord{Lease: clientv3.LeaseID(kv.Lease)}
+	err = json.Unmarshal(kv.Value, &r)
+	return r, kv.ModRevision, err
+}
+
+// put() answers the operation to write the record on its lease.
+func (s *etcdService) put(key string, r etcdRecord) (clientv3.Op, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return clientv3.Op{}, err
+	}
+	return clientv3.OpPut(key, string(b), clientv3.WithLease(r.Lease)), nil
+}
+
+// lease() answers the lease for a lock replacing cur, and its length in
+// seconds. cur's lease is kept alive and reused if it's the same length,
+// otherwise a new lease is granted.
+func (s *etcdService) lease(ctx context.Context, cur etcdRecord, opts *lid.LockOpts) (clientv3.LeaseID, int64, error) {
+	ttl := s.getTtl(opts)
+	if ttl == emptyDuration {
+		ttl = s.getDuration(opts) + s.opts.ClockSkewTolerance + expiredRetention
+	}
+	// A lease must never end before the lock expires.
+	if d := s.getDuration(opts); d > ttl {
+		ttl = d
+	}
+	secs := int64((ttl + time.Second - 1) / time.Second)
+
+	if cur.Lease != clientv3.NoLease && cur.LeaseTtl == secs {
+		err := s.keepAlive(ctx, cur.Lease)
+		if err == nil {
+			return cur.Lease, secs, nil
+		}
+		// The lease ended since I read the record, so grant another.
+		if err != rpctypes.ErrLeaseNotFound {
+			return clientv3.NoLease, 0, transientErr(err)
+		}
+	}
+
+	span := s.startSpan(ctx, "LeaseGrant")
+	defer span.End()
+	resp, err := s.client.Grant(ctx, secs)
+	if err != nil {
+		span.SetError(err)
+		return clientv3.NoLease, 0, transientErr(err)
+	}
+	return resp.ID, secs, nil
+}
+
+// keepAlive() restarts the lease at its full length.
+func (s *etcdService) keepAlive(ctx context.Context, lease clientv3.LeaseID) error {
+	span := s.startSpan(ctx, "LeaseKeepAliveOnce")
+	defer span.End()
+	_, err := s.client.KeepAliveOnce(ctx, lease)
+	if err != nil {
+		span.SetError(err)
+	}
+	return err
+}
+
+// revoke() revokes the lease, unless it's keep. Errors are ignored,
+// since a lease I fail to revoke still ends on its own.
+func (s *etcdService) revoke(ctx context.Context, lease, keep clientv3.LeaseID) {
+	if lease == clientv3.NoLease || lease == keep {
+		return
+	}
+	span := s.startSpan(ctx, "LeaseRevoke")
+	defer span.End()
+	if _, err := s.client.Revoke(ctx, lease); err != nil {
+		span.SetError(err)
+	}
+}
+
+// commit() performs op if the key is still at the revision, answering
+// false if it has changed.
+func (s *etcdService) commit(ctx context.Context, key string, rev int64, op clientv3.Op) (bool, error) {
+	span := s.startSpan(ctx, "Txn")
+	defer span.End()
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+	resp, err := s.client.Txn(ctx).If(cmp).Then(op).Commit()
+	if err != nil {
+		span.SetError(err)
+		return false, transientErr(err)
+	}
+	return resp.Succeeded, nil
+}
+
+func (s *etcdService) getDuration(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.Duration != emptyDuration {
+		return opts.Duration
+	}
+	return s.opts.Duration
+}
+
+func (s *etcdService) getTtl(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.TimeToLive != emptyDuration {
+		return opts.TimeToLive
+	}
+	return s.opts.TimeToLive
+}
+
+func (s *etcdService) key(signature string) string {
+	return s.prefix + signature
+}
+
+// startSpan() answers a child span of ctx for an etcd request.
+func (s *etcdService) startSpan(ctx context.Context, operation string) lid.Span {
+	span := lid.StartSpan(ctx, "etcd."+operation)
+	span.SetAttribute("db.system", "etcd")
+	span.SetAttribute("db.operation", operation)
+	return span
+}
+
+// ------------------------------------------------------------
+// ETCD-RECORD
+
+// etcdRecord stores a single lock.
+type etcdRecord struct {
+	Signee   string           `json:"signee"`
+	Level    int              `json:"level"`
+	Expires  int64            `json:"expires"`             // The time at which this lock expires (epoch nanoseconds).
+	LeaseTtl int64            `json:"lease_ttl,omitempty"` // The length of the lease, in seconds.
+	Lease    clientv3.LeaseID `json:"-"`                   // The record's lease, read from the key.
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func lockContext(opts *lid.LockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+func unlockContext(opts *lid.UnlockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+// etcdContext() answers ctx, or the background context if ctx is nil.
+func etcdContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// transientErr() wraps errors that may succeed if retried, such
+// as an unavailable cluster or a lost leader.
+func transientErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == context.DeadlineExceeded {
+		return lid.NewTransientError(err)
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return lid.NewTransientError(err)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultPrefix = "lid"
+	// How long a record without a TimeToLive is kept after it expires,
+	// so the next lock can report its previous owner.
+	expiredRetention = time.Minute
+	// The number of times I'll decide again after losing a race.
+	maxConflicts = 10
+)
+
+var (
+	emptyDuration time.Duration
+)
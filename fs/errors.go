@@ -0,0 +1,14 @@
+package lidfs
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errDirRequired      = errors.New("Bad request: Dir required")
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errUnsupported      = errors.New("The fs backend requires flock, which this platform doesn't support")
+)
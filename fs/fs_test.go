@@ -0,0 +1,196 @@
+package lidfs
+
+import (
+	"github.com/hackborn/lid"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestTimeToLive verifies a record is gone once it outlives its time to live.
+func TestTimeToLive(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	opts := lid.ServiceOpts{Duration: time.Second * 10, TimeToLive: time.Minute, Clock: clock}
+	s, err := NewService(opts, t.TempDir())
+	lid.MustErr(err)
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	clock.Advance(2 * time.Minute)
+	if _, err = s.Check("a"); err != lid.ErrNotFound {
+		t.Fatal("expected the lock to be gone but have", err)
+	}
+	resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("expected a new lock but have", resp.Status, err)
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	s, err := lid.Open("fs://" + dir + "?duration=10s")
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a/b", Signee: "0"}, nil)
+	lid.MustErr(err)
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+recordExt))
+	lid.MustErr(err)
+	if len(matches) != 1 {
+		t.Fatal("expected one record but have", matches)
+	}
+}
+
+// TestLongSignatures verifies signatures past the file system's
+// name limit are locked separately.
+func TestLongSignatures(t *testing.T) {
+	s, err := NewService(lid.ServiceOpts{Duration: time.Second * 10}, t.TempDir())
+	lid.MustErr(err)
+	a, b := strings.Repeat("a", 1000), strings.Repeat("a", 999)+"b"
+	resp, err := s.Lock(lid.LockRequest{Signature: a, Signee: "0"}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("have", resp, err)
+	}
+	resp, err = s.Lock(lid.LockRequest{Signature: b, Signee: "1"}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("have", resp, err)
+	}
+	if cresp, err := s.Check(a); err != nil || cresp.Signee != "0" {
+		t.Fatal("have", cresp, err)
+	}
+}
+
+// TestStress runs several processes that each repeatedly take the same
+// lock and increment a counter file without any other protection. If
+// the lock is ever held by two processes at once an increment is lost.
+func TestStress(t *testing.T) {
+	dir := t.TempDir()
+	const processes, iterations = 4, 25
+
+	var cmds []*exec.Cmd
+	var outs []*strings.Builder
+	for i := 0; i < processes; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStressHelper$")
+		cmd.Env = append(os.Environ(), stressDirEnv+"="+dir, stressSigneeEnv+"="+strconv.Itoa(i), stressIterationsEnv+"="+strconv.Itoa(iterations))
+		out := &strings.Builder{}
+		cmd.Stdout, cmd.Stderr = out, out
+		lid.MustErr(cmd.Start())
+		cmds = append(cmds, cmd)
+		outs = append(outs, out)
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal("helper", i, "failed:", err, outs[i].String())
+		}
+	}
+
+	if have := readCounter(t, dir); have != processes*iterations {
+		t.Fatal("expected count", processes*iterations, "but have", have)
+	}
+}
+
+// TestStressHelper is the process started by TestStress. It does
+// nothing unless started from there.
+func TestStressHelper(t *testing.T) {
+	dir := os.Getenv(stressDirEnv)
+	if dir == "" {
+		t.Skip("only run by TestStress")
+	}
+	signee := os.Getenv(stressSigneeEnv)
+	iterations, err := strconv.Atoi(os.Getenv(stressIterationsEnv))
+	lid.MustErr(err)
+
+	s, err := NewService(lid.ServiceOpts{Duration: time.Minute}, dir)
+	lid.MustErr(err)
+	req := lid.LockRequest{Signature: "stress", Signee: signee}
+	for i := 0; i < iterations; i++ {
+		for {
+			_, err = s.Lock(req, nil)
+			if err == nil {
+				break
+			} else if err != lid.ErrForbidden {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		// Deliberately racy: only the lock makes this safe.
+		count := readCounter(t, dir)
+		time.Sleep(time.Millisecond)
+		lid.MustErr(ioutil.WriteFile(filepath.Join(dir, counterFile), []byte(strconv.Itoa(count+1)), 0644))
+		_, err = s.Unlock(lid.UnlockRequest{Signature: req.Signature, Signee: signee}, nil)
+		lid.MustErr(err)
+	}
+}
+
+func readCounter(t *testing.T, dir string) int {
+	b, err := ioutil.ReadFile(filepath.Join(dir, counterFile))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	lid.MustErr(err)
+	count, err := strconv.Atoi(string(b))
+	if err != nil {
+		t.Fatalf("bad counter (%s)", b)
+	}
+	return count
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *fsService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *fsService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type fsServiceBootstrap struct {
+	t *testing.T
+}
+
+func (b *fsServiceBootstrap) OpenService() lid.Service {
+	opts := lid.ServiceOpts{Duration: time.Second * 10}
+	service, err := _newService(opts, b.t.TempDir())
+	lid.MustErr(err)
+	return service
+}
+
+func (b *fsServiceBootstrap) CloseService() error {
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &fsServiceBootstrap{t: t}
+	services = append(services, bootstrap)
+	return services
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	counterFile         = "counter"
+	stressDirEnv        = "LIDFS_STRESS_DIR"
+	stressIterationsEnv = "LIDFS_STRESS_ITERATIONS"
+	stressSigneeEnv     = "LIDFS_STRESS_SIGNEE"
+)
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package lidfs
+
+// ------------------------------------------------------------
+// GUARD
+
+// guard is unavailable: the service requires flock.
+type guard struct{}
+
+func acquireGuard(name string) (*guard, error) {
+	return nil, errUnsupported
+}
+
+func (g *guard) release() {
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package lidfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ------------------------------------------------------------
+// GUARD
+
+// guard is an exclusive flock on a guard file.
+type guard struct {
+	f *os.File
+}
+
+// acquireGuard() blocks until I hold the flock on the named file,
+// creating it if necessary.
+func acquireGuard(name string) (*guard, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &guard{f: f}, nil
+}
+
+// release() drops the flock. Closing the file releases it.
+func (g *guard) release() {
+	g.f.Close()
+}
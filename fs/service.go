@@ -0,0 +1,248 @@
+package lidfs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/hackborn/lid"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ------------------------------------------------------------
+// FS-SERVICE
+
+// fsService provides a lid.Service implementation on a local directory,
+// for locking between processes on a single host. Each signature has a
+// record file holding the owner, level and expiry, and a guard file.
+//
+// Every change holds an exclusive flock on the guard file, reads the
+// record, then writes the new record to a temporary file and renames it
+// over the old one, so readers only ever see a complete record. Guard
+// files are never removed: a process may be waiting on the lock of one
+// I would remove, while another creates a new one.
+type fsService struct {
+	opts lid.ServiceOpts
+	dir  string
+}
+
+// init() registers the "fs" backend, i.e. fs:///var/lock/myapp?duration=30s
+func init() {
+	lid.Register("fs", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		return NewService(opts, u.Path)
+	})
+}
+
+// NewService constructs a new service storing locks in dir,
+// creating it if it doesn't exist.
+func NewService(opts lid.ServiceOpts, dir string) (lid.Service, error) {
+	return _newService(opts, dir)
+}
+
+func _newService(opts lid.ServiceOpts, dir string) (*fsService, error) {
+	if dir == "" {
+		return nil, errDirRequired
+	}
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &fsService{opts: opts, dir: dir}, nil
+}
+
+func (s *fsService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	name := s.name(req.Signature)
+	guard, err := acquireGuard(name + guardExt)
+	if err != nil {
+		return lid.LockResponse{}, err
+	}
+	defer guard.release()
+
+	now := s.opts.Now()
+	cur, ok, err := s.read(name, now)
+	if err != nil {
+		return lid.LockResponse{}, err
+	}
+
+	// Acquire the lock. See Service.Lock() for the rules.
+	resp := lid.LockResponse{Status: lid.LockOk}
+	if ok {
+		expired := now.Add(-s.opts.ClockSkewTolerance).UnixNano()
+		if cur.Signee == req.Signee {
+			resp.Status = lid.LockRenewed
+		} else if cur.Level < req.Level || cur.Expires < expired {
+			resp = lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: cur.Signee}
+		} else {
+			return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
+		}
+	}
+
+	r := fsRecord{Signee: req.Signee, Level: req.Level, Expires: now.Add(s.getDuration(opts)).UnixNano()}
+	if ttl := s.getTtl(opts); ttl != emptyDuration {
+		r.Ttl = now.Add(ttl).UnixNano()
+	}
+	err = s.write(name, r)
+	if err != nil {
+		return lid.LockResponse{}, err
+	}
+	return resp, nil
+}
+
+func (s *fsService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	name := s.name(req.Signature)
+	guard, err := acquireGuard(name + guardExt)
+	if err != nil {
+		return lid.UnlockResponse{}, err
+	}
+	defer guard.release()
+
+	cur, ok, err := s.read(name, s.opts.Now())
+	if err != nil {
+		return lid.UnlockResponse{}, err
+	}
+
+	// Release the lock. See Service.Unlock() for the rules.
+	if !ok {
+		return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
+	}
+	if cur.Signee != req.Signee {
+		return lid.UnlockResponse{}, lid.ErrForbidden
+	}
+	err = os.Remove(name + recordExt)
+	if err != nil && !os.IsNotExist(err) {
+		return lid.UnlockResponse{}, err
+	}
+	return lid.UnlockResponse{Status: lid.UnlockOk}, nil
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *fsService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	cur, ok, err := s.read(s.name(signature), s.opts.Now())
+	if err != nil {
+		return lid.CheckResponse{}, err
+	}
+	if !ok {
+		return lid.CheckResponse{}, lid.ErrNotFound
+	}
+	return lid.CheckResponse{Signee: cur.Signee, Level: cur.Level}, nil
+}
+
+// read() answers the record at name, and false if there is none
+// or it has outlived its time to live.
+func (s *fsService) read(name string, now time.Time) (fsRecord, bool, error) {
+	b, err := ioutil.ReadFile(name + recordExt)
+	if os.IsNotExist(err) {
+		return fsRecord{}, false, nil
+	} else if err != nil {
+		return fsRecord{}, false, err
+	}
+	r := fsRecord{}
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return fsRecord{}, false, err
+	}
+	if r.Ttl != 0 && r.Ttl < now.UnixNano() {
+		return fsRecord{}, false, nil
+	}
+	return r, true, nil
+}
+
+// write() atomically replaces the record at name.
+func (s *fsService) write(name string, r fsRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.dir, tempPattern)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name+recordExt)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// name() answers the path of the signature's files, without extension.
+// Signatures are encoded so any string is a safe file name. An encoding
+// too long for the file system's name limit (usually 255 bytes) is
+// replaced by a hash, marked with a character the encoding never uses.
+func (s *fsService) name(signature string) string {
+	name := base64.RawURLEncoding.EncodeToString([]byte(signature))
+	if len(name) > maxNameSize {
+		sum := sha256.Sum256([]byte(signature))
+		name = hashedNamePrefix + hex.EncodeToString(sum[:])
+	}
+	return filepath.Join(s.dir, name)
+}
+
+func (s *fsService) getDuration(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.Duration != emptyDuration {
+		return opts.Duration
+	}
+	return s.opts.Duration
+}
+
+func (s *fsService) getTtl(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.TimeToLive != emptyDuration {
+		return opts.TimeToLive
+	}
+	return s.opts.TimeToLive
+}
+
+// ------------------------------------------------------------
+// FS-RECORD
+
+// fsRecord is the contents of a record file.
+type fsRecord struct {
+	Signee  string `json:"signee"`
+	Level   int    `json:"level"`
+	Expires int64  `json:"expires"`       // The time at which this lock expires (epoch nanoseconds).
+	Ttl     int64  `json:"ttl,omitempty"` // The time at which this record is treated as deleted (epoch nanoseconds).
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	guardExt    = ".guard"
+	recordExt   = ".lock"
+	tempPattern = ".lid-*"
+	// The longest encoded signature used as a name, leaving room for
+	// the extensions within a 255 byte limit.
+	maxNameSize      = 240
+	hashedNamePrefix = "~"
+)
+
+var (
+	emptyDuration time.Duration
+)
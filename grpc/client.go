@@ -0,0 +1,245 @@
+package lidgrpc
+
+import (
+	"context"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/grpc/lidpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"io"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// SESSION
+
+// Session is a lid.Service whose locks are all released by the server
+// when the session ends, either because it was closed or because the
+// connection broke. Done is closed when the session ends.
+type Session interface {
+	lid.Service
+	io.Closer
+	Done() <-chan struct{}
+}
+
+// ------------------------------------------------------------
+// GRPC-SERVICE
+
+// grpcService provides a lid.Service implementation on a gRPC
+// lock server (see NewServer).
+type grpcService struct {
+	client  lidpb.LocksClient
+	session string
+}
+
+// NewService constructs a new service on the connection to a lock server.
+func NewService(conn grpc.ClientConnInterface) (lid.Service, error) {
+	return _newService(conn)
+}
+
+func _newService(conn grpc.ClientConnInterface) (*grpcService, error) {
+	if conn == nil {
+		return nil, errConnRequired
+	}
+	return &grpcService{client: lidpb.NewLocksClient(conn)}, nil
+}
+
+func (s *grpcService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	ctx := lockContext(opts)
+	span := lid.StartSpan(ctx, "grpc.Lock")
+	defer span.End()
+	preq := &lidpb.LockRequest{
+		Signature: req.Signature,
+		Signee:    req.Signee,
+		Level:     int32(req.Level),
+		Opts:      lockOptsToPb(opts),
+		Session:   s.session,
+	}
+	resp, err := s.client.Lock(ctx, preq)
+	if err != nil {
+		span.SetError(err)
+		return lid.LockResponse{}, serviceErr(err)
+	}
+	return lid.LockResponse{Status: lid.LockResponseStatus(resp.GetStatus()), PreviousSignee: resp.GetPreviousSignee()}, nil
+}
+
+func (s *grpcService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	ctx := unlockContext(opts)
+	span := lid.StartSpan(ctx, "grpc.Unlock")
+	defer span.End()
+	preq := &lidpb.UnlockRequest{Signature: req.Signature, Signee: req.Signee, Session: s.session}
+	resp, err := s.client.Unlock(ctx, preq)
+	if err != nil {
+		span.SetError(err)
+		return lid.UnlockResponse{}, serviceErr(err)
+	}
+	return lid.UnlockResponse{Status: lid.UnlockResponseStatus(resp.GetStatus())}, nil
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *grpcService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	resp, err := s.client.Check(context.Background(), &lidpb.CheckRequest{Signature: signature})
+	if err != nil {
+		return lid.CheckResponse{}, serviceErr(err)
+	}
+	return lid.CheckResponse{Signee: resp.GetSignee(), Level: int(resp.GetLevel())}, nil
+}
+
+// ------------------------------------------------------------
+// SESSION-SERVICE
+
+// sessionService is a grpcService that takes its locks through a
+// KeepAlive session, pinging the server at every interval.
+type sessionService struct {
+	grpcService
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession opens a KeepAlive session on the connection to a lock
+// server, pinging the server at every interval, which must be shorter
+// than the server's SessionTimeout. Close the session to release its locks.
+func NewSession(conn grpc.ClientConnInterface, interval time.Duration) (Session, error) {
+	gs, err := _newService(conn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := gs.client.KeepAlive(ctx)
+	if err != nil {
+		cancel()
+		return nil, serviceErr(err)
+	}
+	resp, err := stream.Recv()
+	if err == nil && resp.GetSession() == "" {
+		err = errNoSessionMessage
+	}
+	if err != nil {
+		cancel()
+		return nil, serviceErr(err)
+	}
+	gs.session = resp.GetSession()
+	s := &sessionService{grpcService: *gs, cancel: cancel, done: make(chan struct{})}
+	go s.ping(ctx, stream, interval)
+	go s.listen(stream)
+	return s, nil
+}
+
+func (s *sessionService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	select {
+	case <-s.done:
+		return lid.LockResponse{}, errSessionEnded
+	default:
+		return s.grpcService.Lock(req, opts)
+	}
+}
+
+// Close() ends the session, and with it the session's locks.
+func (s *sessionService) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+	})
+	return nil
+}
+
+func (s *sessionService) Done() <-chan struct{} {
+	return s.done
+}
+
+// ping() sends a request at every interval until the stream ends.
+func (s *sessionService) ping(ctx context.Context, stream lidpb.Locks_KeepAliveClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if stream.Send(&lidpb.KeepAliveRequest{}) != nil {
+				return
+			}
+		}
+	}
+}
+
+// listen() reads responses until the stream ends, then ends the session.
+func (s *sessionService) listen(stream lidpb.Locks_KeepAliveClient) {
+	defer close(s.done)
+	for {
+		_, err := stream.Recv()
+		if err != nil {
+			s.cancel()
+			return
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func lockOptsToPb(opts *lid.LockOpts) *lidpb.LockOpts {
+	if opts == nil {
+		return nil
+	}
+	o := &lidpb.LockOpts{Force: opts.Force}
+	if opts.Duration != 0 {
+		o.Duration = durationpb.New(opts.Duration)
+	}
+	if opts.TimeToLive != 0 {
+		o.TimeToLive = durationpb.New(opts.TimeToLive)
+	}
+	return o
+}
+
+// serviceErr() converts a gRPC status to the error the server's service answered.
+func serviceErr(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return lid.ErrBadRequest
+	case codes.NotFound:
+		return lid.ErrNotFound
+	case codes.PermissionDenied:
+		return lid.ErrForbidden
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return lid.NewTransientError(err)
+	}
+	return err
+}
+
+func lockContext(opts *lid.LockOpts) context.Context {
+	if opts != nil && opts.Context != nil {
+		return opts.Context
+	}
+	return context.Background()
+}
+
+func unlockContext(opts *lid.UnlockOpts) context.Context {
+	if opts != nil && opts.Context != nil {
+		return opts.Context
+	}
+	return context.Background()
+}
@@ -0,0 +1,18 @@
+package lidgrpc
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errConnRequired     = errors.New("Connection is required")
+	errSessionEnded     = errors.New("Session ended")
+	errSessionTimeout   = status.Error(codes.DeadlineExceeded, "Session timed out")
+	errUnknownSession   = status.Error(codes.FailedPrecondition, "Unknown session")
+	errNoSessionMessage = errors.New("KeepAlive ended before answering a session")
+)
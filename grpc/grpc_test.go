@@ -0,0 +1,250 @@
+package lidgrpc
+
+import (
+	"context"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/grpc/lidpb"
+	"github.com/hackborn/lid/mem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestSessionClose verifies closing a session releases its locks,
+// and only its locks.
+func TestSessionClose(t *testing.T) {
+	f := newTestFixture(t)
+	sess, err := NewSession(f.conn, time.Second)
+	lid.MustErr(err)
+	_, err = sess.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	_, err = sess.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(err)
+	_, err = sess.Unlock(lid.UnlockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(err)
+	_, err = f.service.Lock(lid.LockRequest{Signature: "b", Signee: "1"}, nil)
+	lid.MustErr(err)
+
+	lid.MustErr(sess.Close())
+	waitForNotFound(t, f.service, "a")
+	if resp, err := f.service.Check("b"); err != nil || resp.Signee != "1" {
+		t.Fatal("expected the other lock to remain but have", resp, err)
+	}
+	if _, err = sess.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil); err != errSessionEnded {
+		t.Fatal("expected the session to be ended but have", err)
+	}
+}
+
+// TestSessionRelock verifies closing a session keeps the locks its
+// signee has since locked again elsewhere.
+func TestSessionRelock(t *testing.T) {
+	f := newTestFixture(t)
+	first, err := NewSession(f.conn, time.Second)
+	lid.MustErr(err)
+	second, err := NewSession(f.conn, time.Second)
+	lid.MustErr(err)
+	defer second.Close()
+	plain, err := NewService(f.conn)
+	lid.MustErr(err)
+	for _, sig := range []string{"a", "b", "c"} {
+		_, err = first.Lock(lid.LockRequest{Signature: sig, Signee: "0"}, nil)
+		lid.MustErr(err)
+	}
+	_, err = second.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	_, err = plain.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(err)
+
+	lid.MustErr(first.Close())
+	waitForNotFound(t, f.service, "c")
+	for _, sig := range []string{"a", "b"} {
+		if resp, err := f.service.Check(sig); err != nil || resp.Signee != "0" {
+			t.Fatal("expected lock", sig, "to remain but have", resp, err)
+		}
+	}
+}
+
+// TestSessionBreak verifies a broken connection releases the session's locks.
+func TestSessionBreak(t *testing.T) {
+	f := newTestFixture(t)
+	conn := f.dial()
+	sess, err := NewSession(conn, time.Second)
+	lid.MustErr(err)
+	_, err = sess.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+
+	conn.Close()
+	select {
+	case <-sess.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the session to end")
+	}
+	waitForNotFound(t, f.service, "a")
+}
+
+// TestSessionTimeout verifies a session that stops pinging, without its
+// stream closing, is ended and releases its locks.
+func TestSessionTimeout(t *testing.T) {
+	f := newTestFixtureWithOpts(t, ServerOpts{SessionTimeout: 200 * time.Millisecond})
+	client := lidpb.NewLocksClient(f.conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.KeepAlive(ctx)
+	lid.MustErr(err)
+	resp, err := stream.Recv()
+	lid.MustErr(err)
+	_, err = client.Lock(ctx, &lidpb.LockRequest{Signature: "a", Signee: "0", Session: resp.GetSession()})
+	lid.MustErr(err)
+
+	// Pinging holds the session past the timeout.
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		lid.MustErr(stream.Send(&lidpb.KeepAliveRequest{}))
+		_, err = stream.Recv()
+		lid.MustErr(err)
+	}
+	if _, err = f.service.Check("a"); err != nil {
+		t.Fatal("expected the lock to remain but have", err)
+	}
+
+	// Then stop, leaving the stream open.
+	if _, err = stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatal("expected the session to time out but have", err)
+	}
+	waitForNotFound(t, f.service, "a")
+}
+
+// TestUnknownSession verifies locking on a session the server doesn't know fails.
+func TestUnknownSession(t *testing.T) {
+	f := newTestFixture(t)
+	s, err := _newService(f.conn)
+	lid.MustErr(err)
+	s.session = "missing"
+	if _, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err = f.service.Check("a"); err != lid.ErrNotFound {
+		t.Fatal("expected no lock but have", err)
+	}
+}
+
+func waitForNotFound(t *testing.T, s lid.Service, signature string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := s.Check(signature); err == lid.ErrNotFound {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("expected lock", signature, "to be released")
+}
+
+// ------------------------------------------------------------
+// TEST-FIXTURE
+
+// testFixture runs a server over bufconn in front of a mem service.
+type testFixture struct {
+	service lid.Service
+	clock   *lid.DebugClock
+	lis     *bufconn.Listener
+	server  *grpc.Server
+	conn    *grpc.ClientConn
+}
+
+func newTestFixture(t *testing.T) *testFixture {
+	return newTestFixtureWithOpts(t, ServerOpts{})
+}
+
+func newTestFixtureWithOpts(t *testing.T, opts ServerOpts) *testFixture {
+	f := _newTestFixture(opts)
+	t.Cleanup(f.close)
+	return f
+}
+
+func _newTestFixture(opts ServerOpts) *testFixture {
+	f := &testFixture{clock: lid.NewDebugClock(), lis: bufconn.Listen(bufSize)}
+	ms, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: f.clock})
+	lid.MustErr(err)
+	f.service = ms
+	f.server = grpc.NewServer()
+	lidpb.RegisterLocksServer(f.server, NewServerWithOpts(ms, opts))
+	go f.server.Serve(f.lis)
+	f.conn = f.dial()
+	return f
+}
+
+func (f *testFixture) dial() *grpc.ClientConn {
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return f.lis.DialContext(ctx)
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	lid.MustErr(err)
+	return conn
+}
+
+func (f *testFixture) close() {
+	f.conn.Close()
+	f.server.Stop()
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type grpcServiceBootstrap struct {
+	session bool
+	fixture *testFixture
+	closer  func() error
+}
+
+func (b *grpcServiceBootstrap) OpenService() lid.Service {
+	b.fixture = _newTestFixture(ServerOpts{})
+	var service lid.Service
+	var err error
+	b.closer = func() error { return nil }
+	if b.session {
+		var sess Session
+		sess, err = NewSession(b.fixture.conn, time.Second)
+		if sess != nil {
+			service, b.closer = sess, sess.Close
+		}
+	} else {
+		service, err = NewService(b.fixture.conn)
+	}
+	lid.MustErr(err)
+	return lid.NewDebugWrapper(service, b.fixture.clock)
+}
+
+func (b *grpcServiceBootstrap) CloseService() error {
+	err := b.closer()
+	b.fixture.close()
+	return err
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	services = append(services, &grpcServiceBootstrap{})
+	services = append(services, &grpcServiceBootstrap{session: true})
+	return services
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	bufSize = 1024 * 1024
+)
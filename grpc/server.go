@@ -0,0 +1,281 @@
+package lidgrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative lidpb/lid.proto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/grpc/lidpb"
+	"github.com/micro-go/lock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// SERVER
+
+// ServerOpts provides the options for the server.
+type ServerOpts struct {
+	// SessionTimeout ends a session that hasn't pinged within it, releasing
+	// its locks, so a half-open connection doesn't hold them until the
+	// transport notices. Clients must ping more often. Default 30s.
+	SessionTimeout time.Duration
+}
+
+// NewServer answers a gRPC front end to the service. Register it with
+// lidpb.RegisterLocksServer.
+func NewServer(s lid.Service) lidpb.LocksServer {
+	return NewServerWithOpts(s, ServerOpts{})
+}
+
+// NewServerWithOpts answers a gRPC front end to the service with the
+// options. Serving it with keepalive.ServerParameters as well also
+// closes the dead connections themselves.
+func NewServerWithOpts(s lid.Service, opts ServerOpts) lidpb.LocksServer {
+	if opts.SessionTimeout <= 0 {
+		opts.SessionTimeout = defaultSessionTimeout
+	}
+	return &server{service: s, opts: opts, sessions: make(map[string]*session), owners: make(map[string]*session)}
+}
+
+type server struct {
+	lidpb.UnimplementedLocksServer
+
+	service  lid.Service
+	opts     ServerOpts
+	mutex    sync.RWMutex
+	sessions map[string]*session
+	// The session that last locked each signature, while it's held by
+	// one. A session only releases the locks it still owns.
+	owners map[string]*session
+}
+
+func (s *server) Lock(ctx context.Context, req *lidpb.LockRequest) (*lidpb.LockResponse, error) {
+	lreq := lid.LockRequest{Signature: req.GetSignature(), Signee: req.GetSignee(), Level: int(req.GetLevel())}
+	opts := lockOptsFromPb(req.GetOpts())
+	opts.Context = ctx
+	if req.GetSession() == "" {
+		resp, err := s.service.Lock(lreq, opts)
+		if err == nil {
+			s.own(lreq.Signature, nil)
+		}
+		return lockResponseToPb(resp), statusErr(err)
+	}
+
+	sess := s.find(req.GetSession())
+	if sess == nil {
+		return nil, errUnknownSession
+	}
+	// Hold the session while locking, so it can't end without releasing this lock.
+	defer lock.Locker(&sess.mutex).Unlock()
+	if sess.ended {
+		return nil, errUnknownSession
+	}
+	resp, err := s.service.Lock(lreq, opts)
+	if err == nil {
+		sess.locks[lreq.Signature] = lreq.Signee
+		s.own(lreq.Signature, sess)
+	}
+	return lockResponseToPb(resp), statusErr(err)
+}
+
+func (s *server) Unlock(ctx context.Context, req *lidpb.UnlockRequest) (*lidpb.UnlockResponse, error) {
+	ureq := lid.UnlockRequest{Signature: req.GetSignature(), Signee: req.GetSignee()}
+	resp, err := s.service.Unlock(ureq, &lid.UnlockOpts{Context: ctx})
+	if err == nil && resp.Status == lid.UnlockOk {
+		s.own(ureq.Signature, nil)
+	}
+	if err == nil && req.GetSession() != "" {
+		if sess := s.find(req.GetSession()); sess != nil {
+			sess.forget(ureq)
+		}
+	}
+	return &lidpb.UnlockResponse{Status: lidpb.UnlockResponseStatus(resp.Status)}, statusErr(err)
+}
+
+func (s *server) Check(ctx context.Context, req *lidpb.CheckRequest) (*lidpb.CheckResponse, error) {
+	resp, err := s.service.Check(req.GetSignature())
+	if err != nil {
+		return nil, statusErr(err)
+	}
+	return &lidpb.CheckResponse{Signee: resp.Signee, Level: int32(resp.Level)}, nil
+}
+
+// KeepAlive() holds a session until the stream ends or the client
+// stops pinging, then releases every lock taken with it. A lock that
+// was since locked again through this server, by another session or
+// none, belongs to that call and is kept. I can't see a lock renewed
+// directly on the service, so that is still released.
+func (s *server) KeepAlive(stream lidpb.Locks_KeepAliveServer) error {
+	sess, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer s.close(sess)
+
+	resp := &lidpb.KeepAliveResponse{Session: sess.id}
+	if stream.Send(resp) != nil {
+		return nil
+	}
+	pings := receive(stream)
+	timeout := time.After(s.opts.SessionTimeout)
+	for {
+		select {
+		case err = <-pings:
+			if err != nil || stream.Send(resp) != nil {
+				return nil
+			}
+			timeout = time.After(s.opts.SessionTimeout)
+		case <-stream.Context().Done():
+			return nil
+		case <-timeout:
+			return errSessionTimeout
+		}
+	}
+}
+
+// receive() answers a channel of the result of every Recv on the
+// stream, which ends with the first error.
+func receive(stream lidpb.Locks_KeepAliveServer) <-chan error {
+	pings := make(chan error)
+	go func() {
+		for {
+			_, err := stream.Recv()
+			select {
+			case pings <- err:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return pings
+}
+
+// open() answers a new session.
+func (s *server) open() (*session, error) {
+	b := make([]byte, sessionIdSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	sess := &session{id: hex.EncodeToString(b), locks: make(map[string]string)}
+	defer lock.Write(&s.mutex).Unlock()
+	s.sessions[sess.id] = sess
+	return sess, nil
+}
+
+// close() ends the session and releases its locks.
+func (s *server) close(sess *session) {
+	func() {
+		defer lock.Write(&s.mutex).Unlock()
+		delete(s.sessions, sess.id)
+	}()
+	defer lock.Locker(&sess.mutex).Unlock()
+	sess.ended = true
+	for sig, signee := range sess.locks {
+		if !s.disown(sig, sess) {
+			continue
+		}
+		// Errors are ignored: the lock may have expired or been taken.
+		s.service.Unlock(lid.UnlockRequest{Signature: sig, Signee: signee}, nil)
+	}
+	sess.locks = nil
+}
+
+// own() records the session, or nil for none, as the last to lock the signature.
+func (s *server) own(signature string, sess *session) {
+	defer lock.Write(&s.mutex).Unlock()
+	if sess == nil {
+		delete(s.owners, signature)
+	} else {
+		s.owners[signature] = sess
+	}
+}
+
+// disown() answers true if the session was the last to lock the
+// signature, which it no longer owns.
+func (s *server) disown(signature string, sess *session) bool {
+	defer lock.Write(&s.mutex).Unlock()
+	if s.owners[signature] != sess {
+		return false
+	}
+	delete(s.owners, signature)
+	return true
+}
+
+func (s *server) find(id string) *session {
+	defer lock.Read(&s.mutex).Unlock()
+	return s.sessions[id]
+}
+
+// ------------------------------------------------------------
+// SESSION
+
+// session tracks the locks taken through one KeepAlive stream.
+type session struct {
+	id    string
+	mutex sync.Mutex
+	locks map[string]string // Signature to signee
+	ended bool
+}
+
+func (s *session) forget(req lid.UnlockRequest) {
+	defer lock.Locker(&s.mutex).Unlock()
+	if s.locks[req.Signature] == req.Signee {
+		delete(s.locks, req.Signature)
+	}
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func lockOptsFromPb(o *lidpb.LockOpts) *lid.LockOpts {
+	opts := &lid.LockOpts{}
+	if o != nil {
+		opts.Force = o.GetForce()
+		if o.Duration != nil {
+			opts.Duration = o.Duration.AsDuration()
+		}
+		if o.TimeToLive != nil {
+			opts.TimeToLive = o.TimeToLive.AsDuration()
+		}
+	}
+	return opts
+}
+
+func lockResponseToPb(r lid.LockResponse) *lidpb.LockResponse {
+	return &lidpb.LockResponse{Status: lidpb.LockResponseStatus(r.Status), PreviousSignee: r.PreviousSignee}
+}
+
+// statusErr() converts an error from a lid.Service to a gRPC status.
+func statusErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == lid.ErrBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err == lid.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case lid.IsTransient(err), err == lid.ErrClockSkew:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if e, ok := err.(*lid.Error); ok && e.Code == lid.Forbidden {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultSessionTimeout = 30 * time.Second
+	sessionIdSize         = 16
+)
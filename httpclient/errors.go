@@ -0,0 +1,12 @@
+package lidhttpclient
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errBaseURLRequired = errors.New("Bad request: Base URL required")
+)
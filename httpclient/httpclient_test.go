@@ -0,0 +1,150 @@
+package lidhttpclient
+
+import (
+	"context"
+	"errors"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"github.com/hackborn/lid/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestErrors verifies server errors arrive as the errors the
+// server's service answered.
+func TestErrors(t *testing.T) {
+	cases := []struct {
+		Err     error
+		WantErr error
+	}{
+		{lid.ErrForbidden, lid.ErrForbidden},
+		{lid.ErrNotFound, lid.ErrNotFound},
+		{lid.ErrBadRequest, lid.ErrBadRequest},
+		{lid.NewTransientError(errors.New("throttled")), nil},
+		{errors.New("broken"), nil},
+	}
+	for i, tc := range cases {
+		server := httptest.NewServer(lidserver.NewHandler(failingService{tc.Err}))
+		s, err := NewService(server.URL, server.Client())
+		lid.MustErr(err)
+		_, err = s.Check("a")
+		server.Close()
+		if tc.WantErr != nil && err != tc.WantErr {
+			t.Fatal("case", i, "expected", tc.WantErr, "but have", err)
+		}
+		if tc.WantErr == nil && (err == nil || err.Error() != tc.Err.Error() || lid.IsTransient(err) != lid.IsTransient(tc.Err)) {
+			t.Fatal("case", i, "expected", tc.Err, "but have", err)
+		}
+	}
+}
+
+// TestContextErrors verifies a request the caller cancelled or let
+// expire isn't reported as transient, so it isn't retried.
+func TestContextErrors(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	s, err := NewService(server.URL, server.Client())
+	lid.MustErr(err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cases := []struct {
+		Ctx  context.Context
+		Want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	}
+	for i, tc := range cases {
+		_, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, &lid.LockOpts{Context: tc.Ctx})
+		if err != tc.Want || lid.IsTransient(err) {
+			t.Fatal("case", i, "have", err, "want", tc.Want)
+		}
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	ms, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	server := httptest.NewServer(lidserver.NewHandler(ms))
+	defer server.Close()
+
+	s, err := lid.Open(server.URL)
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a/b c", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if resp, err := ms.Check("a/b c"); err != nil || resp.Signee != "0" {
+		t.Fatal("expected the lock on the server but have", resp, err)
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SERVICES
+
+// failingService answers err to everything.
+type failingService struct {
+	err error
+}
+
+func (s failingService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	return lid.LockResponse{}, s.err
+}
+
+func (s failingService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	return lid.UnlockResponse{}, s.err
+}
+
+func (s failingService) Check(signature string) (lid.CheckResponse, error) {
+	return lid.CheckResponse{}, s.err
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type httpServiceBootstrap struct {
+	server *httptest.Server
+}
+
+func (b *httpServiceBootstrap) OpenService() lid.Service {
+	clock := lid.NewDebugClock()
+	ms, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+	lid.MustErr(err)
+	b.server = httptest.NewServer(lidserver.NewHandler(ms))
+	service, err := _newService(b.server.URL, b.server.Client())
+	lid.MustErr(err)
+	return lid.NewDebugWrapper(service, clock)
+}
+
+func (b *httpServiceBootstrap) CloseService() error {
+	b.server.Close()
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &httpServiceBootstrap{}
+	services = append(services, bootstrap)
+	return services
+}
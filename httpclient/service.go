@@ -0,0 +1,176 @@
+package lidhttpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/server"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// HTTP-SERVICE
+
+// httpService provides a lid.Service implementation on a lid server
+// (see package lidserver).
+type httpService struct {
+	base   string
+	client *http.Client
+}
+
+// init() registers the "http" and "https" backends, i.e. http://locks.internal:8080
+// The server owns the lock options, so the standard parameters are ignored.
+func init() {
+	factory := func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		return NewService(u.Scheme+"://"+u.Host+u.Path, nil)
+	}
+	lid.Register("http", factory)
+	lid.Register("https", factory)
+}
+
+// NewService constructs a new service on the lid server at baseURL,
+// under which the locks are at /locks/. The client is optional and
+// defaults to http.DefaultClient.
+func NewService(baseURL string, client *http.Client) (lid.Service, error) {
+	return _newService(baseURL, client)
+}
+
+func _newService(baseURL string, client *http.Client) (*httpService, error) {
+	if baseURL == "" {
+		return nil, errBaseURLRequired
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpService{base: strings.TrimSuffix(baseURL, "/"), client: client}, nil
+}
+
+func (s *httpService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	body := lidserver.LockBody{LockRequest: req, Opts: opts}
+	resp := lid.LockResponse{}
+	err := s.do(lockContext(opts), http.MethodPost, req.Signature, body, &resp)
+	if err != nil {
+		return lid.LockResponse{}, err
+	}
+	return resp, nil
+}
+
+func (s *httpService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	resp := lid.UnlockResponse{}
+	err := s.do(unlockContext(opts), http.MethodDelete, req.Signature, req, &resp)
+	if err != nil {
+		return lid.UnlockResponse{}, err
+	}
+	return resp, nil
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *httpService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	resp := lid.CheckResponse{}
+	err := s.do(context.Background(), http.MethodGet, signature, nil, &resp)
+	if err != nil {
+		return lid.CheckResponse{}, err
+	}
+	return resp, nil
+}
+
+// do() sends a request for the signature, decoding the response into out.
+func (s *httpService) do(ctx context.Context, method, signature string, in, out interface{}) error {
+	span := lid.StartSpan(ctx, "http."+method)
+	defer span.End()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.base+lidserver.LocksPath+url.PathEscape(signature), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		span.SetError(err)
+		// The caller gave up, so there is nothing to retry.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The request never got an answer, so it may succeed if retried.
+		return lid.NewTransientError(err)
+	}
+	defer resp.Body.Close()
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		err = responseErr(resp)
+		span.SetError(err)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// responseErr() converts a failed response to the error the
+// server's service answered.
+func responseErr(resp *http.Response) error {
+	body := lidserver.ErrorBody{}
+	json.NewDecoder(io.LimitReader(resp.Body, maxErrorSize)).Decode(&body)
+	if body.Error == "" {
+		body.Error = resp.Status
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return lid.ErrBadRequest
+	case http.StatusNotFound:
+		return lid.ErrNotFound
+	case http.StatusConflict:
+		return lid.ErrForbidden
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return lid.NewTransientError(errors.New(body.Error))
+	}
+	return errors.New(body.Error)
+}
+
+func lockContext(opts *lid.LockOpts) context.Context {
+	if opts != nil && opts.Context != nil {
+		return opts.Context
+	}
+	return context.Background()
+}
+
+func unlockContext(opts *lid.UnlockOpts) context.Context {
+	if opts != nil && opts.Context != nil {
+		return opts.Context
+	}
+	return context.Background()
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	maxErrorSize = 1 << 12
+)
@@ -0,0 +1,59 @@
+package lidmem
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/micro-go/lock"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// MEM-AUDIT-LOG
+
+// memAuditLog provides an in-memory lid.AuditLog, keeping the
+// most recent events in a ring buffer.
+type memAuditLog struct {
+	mutex  sync.RWMutex
+	events []lid.AuditEvent
+	next   int
+	full   bool
+}
+
+// NewAuditLog constructs a new in-memory audit log that holds
+// the most recent size events.
+func NewAuditLog(size int) (lid.AuditLog, error) {
+	if size < 1 {
+		return nil, errSizeRequired
+	}
+	return &memAuditLog{events: make([]lid.AuditEvent, size)}, nil
+}
+
+func (l *memAuditLog) Record(event lid.AuditEvent) error {
+	defer lock.Write(&l.mutex).Unlock()
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	return nil
+}
+
+func (l *memAuditLog) Query(signature string, from, to time.Time) ([]lid.AuditEvent, error) {
+	defer lock.Read(&l.mutex).Unlock()
+	var events []lid.AuditEvent
+	start, size := 0, l.next
+	if l.full {
+		start, size = l.next, len(l.events)
+	}
+	for i := 0; i < size; i++ {
+		e := l.events[(start+i)%len(l.events)]
+		if e.Signature != signature || e.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Time.Before(to) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,90 @@
+package lidmem
+
+import (
+	"github.com/hackborn/lid"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRenewAllocs verifies renewing a lock doesn't allocate.
+func TestRenewAllocs(t *testing.T) {
+	s, err := NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	req := lid.LockRequest{Signature: "a", Signee: "0"}
+	_, err = s.Lock(req, nil)
+	lid.MustErr(err)
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Lock(req, nil)
+	})
+	if allocs != 0 {
+		t.Fatal("expected no allocations per renewal but have", allocs)
+	}
+}
+
+// BenchmarkRenew renews a lock per goroutine.
+func BenchmarkRenew(b *testing.B) {
+	s := newBenchService(b)
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		req := lid.LockRequest{Signature: "sig" + strconv.FormatInt(atomic.AddInt64(&next, 1), 10), Signee: "0"}
+		for pb.Next() {
+			s.Lock(req, nil)
+		}
+	})
+}
+
+// BenchmarkRenewContended renews one lock from every goroutine.
+func BenchmarkRenewContended(b *testing.B) {
+	s := newBenchService(b)
+	req := lid.LockRequest{Signature: "sig", Signee: "0"}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Lock(req, nil)
+		}
+	})
+}
+
+// BenchmarkLockUnlock locks and unlocks a lock per goroutine.
+func BenchmarkLockUnlock(b *testing.B) {
+	s := newBenchService(b)
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		sig := "sig" + strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+		req, ureq := lid.LockRequest{Signature: sig, Signee: "0"}, lid.UnlockRequest{Signature: sig, Signee: "0"}
+		for pb.Next() {
+			s.Lock(req, nil)
+			s.Unlock(ureq, nil)
+		}
+	})
+}
+
+// BenchmarkLockUnlockContended locks and unlocks a few locks
+// shared by every goroutine, each goroutine a different signee.
+func BenchmarkLockUnlockContended(b *testing.B) {
+	s := newBenchService(b)
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		signee := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+		var reqs []lid.LockRequest
+		var ureqs []lid.UnlockRequest
+		for i := 0; i < 4; i++ {
+			sig := "sig" + strconv.Itoa(i)
+			reqs = append(reqs, lid.LockRequest{Signature: sig, Signee: signee})
+			ureqs = append(ureqs, lid.UnlockRequest{Signature: sig, Signee: signee})
+		}
+		for i := 0; pb.Next(); i++ {
+			if _, err := s.Lock(reqs[i%4], nil); err == nil {
+				s.Unlock(ureqs[i%4], nil)
+			}
+		}
+	})
+}
+
+func newBenchService(b *testing.B) lid.Service {
+	s, err := NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	b.ReportAllocs()
+	return s
+}
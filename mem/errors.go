@@ -0,0 +1,25 @@
+package lidmem
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	// ErrTooManyRecords is answered by a lock that would create a record
+	// beyond MaxRecords when none can be reclaimed.
+	ErrTooManyRecords = errors.New("Too many records: MaxRecords reached")
+
+	errSizeRequired         = errors.New("Bad request: Size required")
+	errSnapshotPathRequired = errors.New("Bad request: SnapshotPath required")
+	errSnapshotVersion      = errors.New("Unsupported snapshot version")
+	errPersisterClosed      = errors.New("Persister closed")
+	errWalEntry             = errors.New("Unknown write-ahead log entry")
+
+	// Internal. Answered by a record deleted while a lock waited on it.
+	errRecordDeleted = errors.New("Record deleted")
+	// Internal. Answered when a lock reclaimed records to make room.
+	errReclaimed = errors.New("Records reclaimed")
+)
@@ -0,0 +1,175 @@
+package lidmem
+
+import (
+	"github.com/hackborn/lid"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestLinearizable runs concurrent locks and unlocks against a few
+// signatures, and verifies each signature's history against a
+// sequential model of a lock. Run it with -race.
+func TestLinearizable(t *testing.T) {
+	const workers, sigs, opsPerWorker = 6, 3, 24
+	rounds := 500
+	if testing.Short() {
+		rounds = 100
+	}
+	// Interleave the workers even on a single CPU.
+	if runtime.GOMAXPROCS(0) < workers {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+	}
+	for round := 0; round < rounds; round++ {
+		s, err := NewService(lid.ServiceOpts{Duration: time.Hour})
+		lid.MustErr(err)
+		var clock int64
+		histories := make([][]linearOp, sigs)
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(seed int64) {
+				defer wg.Done()
+				rnd := rand.New(rand.NewSource(seed))
+				for i := 0; i < opsPerWorker; i++ {
+					// Keep each history within the checker's limit.
+					sig := i % sigs
+					op := linearOp{unlock: rnd.Intn(3) == 0, signee: strconv.Itoa(rnd.Intn(3)), level: rnd.Intn(3)}
+					op.call = atomic.AddInt64(&clock, 1)
+					if op.unlock {
+						op.unlockResp, op.err = s.Unlock(lid.UnlockRequest{Signature: strconv.Itoa(sig), Signee: op.signee}, nil)
+					} else {
+						op.lockResp, op.err = s.Lock(lid.LockRequest{Signature: strconv.Itoa(sig), Signee: op.signee, Level: op.level}, nil)
+					}
+					op.ret = atomic.AddInt64(&clock, 1)
+					mutex.Lock()
+					histories[sig] = append(histories[sig], op)
+					mutex.Unlock()
+				}
+			}(int64(round*workers + w))
+		}
+		wg.Wait()
+		for sig, history := range histories {
+			if !linearizable(history) {
+				t.Fatalf("round %v signature %v history isn't linearizable: %v", round, sig, history)
+			}
+		}
+	}
+}
+
+// TestLinearizableChecker verifies the checker rejects a bad history.
+func TestLinearizableChecker(t *testing.T) {
+	ok := lid.LockResponse{Status: lid.LockOk}
+	cases := []struct {
+		History []linearOp
+		Want    bool
+	}{
+		// Overlapping locks, either may be first.
+		{[]linearOp{{call: 1, ret: 3, signee: "a", lockResp: ok}, {call: 2, ret: 4, signee: "b", lockResp: lid.LockResponse{Status: lid.LockFailed}, err: lid.ErrForbidden}}, true},
+		{[]linearOp{{call: 1, ret: 3, signee: "a", lockResp: lid.LockResponse{Status: lid.LockFailed}, err: lid.ErrForbidden}, {call: 2, ret: 4, signee: "b", lockResp: ok}}, true},
+		// Two owners at once.
+		{[]linearOp{{call: 1, ret: 2, signee: "a", lockResp: ok}, {call: 3, ret: 4, signee: "b", lockResp: ok}}, false},
+		// An unlock that succeeded, but the lock survived it.
+		{[]linearOp{{call: 1, ret: 2, signee: "a", lockResp: ok},
+			{call: 3, ret: 4, unlock: true, signee: "a", unlockResp: lid.UnlockResponse{Status: lid.UnlockOk}},
+			{call: 5, ret: 6, signee: "b", lockResp: lid.LockResponse{Status: lid.LockFailed}, err: lid.ErrForbidden}}, false},
+	}
+	for i, tc := range cases {
+		if have := linearizable(tc.History); have != tc.Want {
+			t.Fatalf("case %v has %v but wants %v", i, have, tc.Want)
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// LINEARIZABILITY
+
+// linearOp is one call in a history, with the clock
+// ticks when it was called and when it returned.
+type linearOp struct {
+	call, ret  int64
+	unlock     bool
+	signee     string
+	level      int
+	lockResp   lid.LockResponse
+	unlockResp lid.UnlockResponse
+	err        error
+}
+
+// linearState is the sequential model of a single lock.
+type linearState struct {
+	held   bool
+	signee string
+	level  int
+}
+
+// step() applies the op to the model, answering the new state,
+// and false if the model doesn't answer what the op did.
+func (s linearState) step(op linearOp) (linearState, bool) {
+	if op.unlock {
+		switch {
+		case !s.held:
+			return s, op.unlockResp.Status == lid.UnlockNoLock && op.err == nil
+		case s.signee != op.signee:
+			return s, op.err == lid.ErrForbidden
+		}
+		return linearState{}, op.unlockResp.Status == lid.UnlockOk && op.err == nil
+	}
+	next := linearState{held: true, signee: op.signee, level: op.level}
+	switch {
+	case !s.held:
+		return next, op.lockResp == lid.LockResponse{Status: lid.LockOk} && op.err == nil
+	case s.signee == op.signee:
+		return next, op.lockResp == lid.LockResponse{Status: lid.LockRenewed} && op.err == nil
+	case op.level > s.level:
+		return next, op.lockResp == lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: s.signee} && op.err == nil
+	}
+	return s, op.lockResp.Status == lid.LockFailed && op.err == lid.ErrForbidden
+}
+
+// linearizable() answers true if the history has a sequential order that
+// respects real time and the model. This is a depth-first search in the
+// manner of Wing and Gong, skipping states it has already visited.
+func linearizable(history []linearOp) bool {
+	if len(history) > 64 {
+		panic("history too long")
+	}
+	full := uint64(1)<<uint(len(history)) - 1
+	type visit struct {
+		done  uint64
+		state linearState
+	}
+	seen := make(map[visit]bool)
+	var search func(done uint64, state linearState) bool
+	search = func(done uint64, state linearState) bool {
+		if done == full {
+			return true
+		}
+		if seen[visit{done, state}] {
+			return false
+		}
+		seen[visit{done, state}] = true
+		// Only an op called before every pending op returned can be next.
+		minRet := int64(-1)
+		for i, op := range history {
+			if done&(1<<uint(i)) == 0 && (minRet < 0 || op.ret < minRet) {
+				minRet = op.ret
+			}
+		}
+		for i, op := range history {
+			if done&(1<<uint(i)) != 0 || op.call > minRet {
+				continue
+			}
+			if next, ok := state.step(op); ok && search(done|1<<uint(i), next) {
+				return true
+			}
+		}
+		return false
+	}
+	return search(0, linearState{})
+}
@@ -0,0 +1,90 @@
+package lidmem
+
+import (
+	"github.com/hackborn/lid"
+	"time"
+)
+
+// ------------------------------------------------------------
+// MACHINE
+
+// Machine is the lock state of the mem service as a deterministic state
+// machine: every decision depends only on the current state and the
+// arguments, never on the local clock. Replicas that apply the same
+// commands in the same order reach the same state.
+//
+// A Machine is not safe for concurrent use; the caller orders the commands.
+type Machine struct {
+	records map[string]*record
+}
+
+// MachineRecord is the state of a single lock in a Machine.
+type MachineRecord struct {
+	Signature  string    `json:"signature,omitempty"`
+	Signee     string    `json:"signee,omitempty"`
+	Level      int       `json:"level,omitempty"`
+	EndTime    time.Time `json:"end_time,omitempty"`
+	TimeToLive time.Time `json:"ttl,omitempty"` // When the record may be reclaimed, if not zero.
+}
+
+// NewMachine constructs a new empty Machine.
+func NewMachine() *Machine {
+	return &Machine{records: make(map[string]*record)}
+}
+
+// Lock applies the lock request at time now, answering the same as
+// Service.Lock. A lock the request acquires ends at endTime.
+func (m *Machine) Lock(req lid.LockRequest, now, endTime time.Time) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	if r := m.records[req.Signature]; r != nil {
+		return r.lock(req, now, endTime, time.Time{}, nil)
+	}
+	m.records[req.Signature] = &record{signature: req.Signature, signee: req.Signee, level: req.Level, endTime: endTime}
+	return lid.LockResponse{Status: lid.LockOk}, nil
+}
+
+// Unlock applies the unlock request, answering the same as Service.Unlock.
+func (m *Machine) Unlock(req lid.UnlockRequest) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	r := m.records[req.Signature]
+	if r == nil {
+		return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
+	}
+	resp, deleted, err := r.unlock(req, time.Time{}, nil)
+	if deleted {
+		delete(m.records, req.Signature)
+	}
+	return resp, err
+}
+
+// Check answers the same as Service.Check.
+func (m *Machine) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	if r := m.records[signature]; r != nil {
+		return r.check(time.Time{})
+	}
+	return lid.CheckResponse{}, lid.ErrNotFound
+}
+
+// Records answers every lock, in no particular order.
+func (m *Machine) Records() []MachineRecord {
+	records := make([]MachineRecord, 0, len(m.records))
+	for _, r := range m.records {
+		records = append(records, r.machineRecord())
+	}
+	return records
+}
+
+// Restore replaces every lock with the records.
+func (m *Machine) Restore(records []MachineRecord) {
+	m.records = make(map[string]*record, len(records))
+	for _, r := range records {
+		m.records[r.Signature] = newRecord(r)
+	}
+}
@@ -2,6 +2,11 @@ package lidmem
 
 import (
 	"github.com/hackborn/lid"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -15,31 +20,321 @@ func TestService(t *testing.T) {
 	lid.RunTestServiceSuite(t, suites)
 }
 
+// TestAudit verifies the events recorded by the audit middleware,
+// and querying them from the ring buffer.
+func TestAudit(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	log, err := NewAuditLog(4)
+	lid.MustErr(err)
+	s, err := NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+	lid.MustErr(err)
+	s = lid.WithAudit(log, lid.AuditOpts{Clock: clock})(s)
+
+	step := func() { clock.Advance(time.Second) }
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	step()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	step()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	step()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1", Level: 1}, nil)
+	step()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "2", Level: 2}, &lid.LockOpts{Force: true})
+	step()
+	s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "2"}, nil)
+
+	at := func(sec int64) time.Time { return time.Unix(1000+sec, 0) }
+	cases := []struct {
+		From, To time.Time
+		Want     []lid.AuditEvent
+	}{
+		// The ring buffer only holds four events, so the acquire on "a" is gone
+		{time.Time{}, time.Time{}, []lid.AuditEvent{
+			{Signature: "a", Signee: "0", Action: lid.AuditRenew, Time: at(2)},
+			{Signature: "a", Signee: "1", Level: 1, Action: lid.AuditTransfer, PreviousSignee: "0", Time: at(3)},
+			{Signature: "a", Signee: "2", Level: 2, Action: lid.AuditForce, PreviousSignee: "1", Time: at(4)},
+			{Signature: "a", Signee: "2", Action: lid.AuditRelease, Time: at(5)},
+		}},
+		{at(3), at(5), []lid.AuditEvent{
+			{Signature: "a", Signee: "1", Level: 1, Action: lid.AuditTransfer, PreviousSignee: "0", Time: at(3)},
+			{Signature: "a", Signee: "2", Level: 2, Action: lid.AuditForce, PreviousSignee: "1", Time: at(4)},
+		}},
+	}
+	for i, tc := range cases {
+		have, err := log.Query("a", tc.From, tc.To)
+		lid.MustErr(err)
+		if !reflect.DeepEqual(have, tc.Want) {
+			t.Fatal("case", i, "have", have, "want", tc.Want)
+		}
+	}
+}
+
+// TestPersist verifies restoring from the snapshot and write-ahead log,
+// after both a clean shutdown and a crash.
+func TestPersist(t *testing.T) {
+	dir := t.TempDir()
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	opts := lid.ServiceOpts{Duration: time.Second * 10, Clock: clock}
+	mopts := MemOpts{SnapshotPath: filepath.Join(dir, "snapshot.json"), WalPath: filepath.Join(dir, "wal.log")}
+
+	s, err := NewServiceWithOpts(opts, mopts)
+	lid.MustErr(err)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(s.Snapshot())
+	clock.Advance(time.Second * 5)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "1", Level: 1}, nil)
+	s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil)
+
+	// Crash: no Close, and a torn write at the end of the log.
+	f, err := os.OpenFile(mopts.WalPath, os.O_WRONLY|os.O_APPEND, 0644)
+	lid.MustErr(err)
+	f.WriteString(`{"op":"lock","rec`)
+	f.Close()
+
+	s, err = NewServiceWithOpts(opts, mopts)
+	lid.MustErr(err)
+	wantState(t, s, map[string]lid.CheckResponse{"b": {Signee: "1", Level: 1}, "c": {Signee: "0"}})
+
+	// Restored locks keep their expiry: c was taken at 5s, for 10s.
+	clock.Advance(time.Second * 9)
+	if _, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "2"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the restored lock to hold but have", err)
+	}
+	clock.Advance(time.Second * 2)
+	resp, err := s.Lock(lid.LockRequest{Signature: "c", Signee: "2"}, nil)
+	if err != nil || resp.Status != lid.LockTransferred {
+		t.Fatal("expected the restored lock to expire but have", resp.Status, err)
+	}
+	lid.MustErr(s.Close())
+
+	// Clean shutdown, without a log.
+	s, err = NewServiceWithOpts(opts, MemOpts{SnapshotPath: mopts.SnapshotPath})
+	lid.MustErr(err)
+	wantState(t, s, map[string]lid.CheckResponse{"b": {Signee: "1", Level: 1}, "c": {Signee: "2"}})
+	lid.MustErr(s.Close())
+
+	lid.MustErr(ioutil.WriteFile(mopts.SnapshotPath, []byte(`{"version":99}`), 0644))
+	if _, err = NewServiceWithOpts(opts, mopts); err != errSnapshotVersion {
+		t.Fatal("expected a version error but have", err)
+	}
+}
+
+// TestPersistFailure verifies a change that fails to log isn't made,
+// and that every change fails once the service is closed.
+func TestPersistFailure(t *testing.T) {
+	dir := t.TempDir()
+	opts := lid.ServiceOpts{Duration: time.Second * 10}
+	mopts := MemOpts{SnapshotPath: filepath.Join(dir, "snapshot.json"), WalPath: filepath.Join(dir, "wal.log")}
+	s, err := NewServiceWithOpts(opts, mopts)
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+
+	// Break the log out from under the service.
+	s.(*memService).persist.wal.Close()
+	resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "1", Level: 1}, nil)
+	if err == nil || resp.Status != lid.LockFailed {
+		t.Fatal("transfer has", resp, err)
+	}
+	resp, err = s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	if err == nil || resp.Status != lid.LockFailed {
+		t.Fatal("new lock has", resp, err)
+	}
+	uresp, err := s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil)
+	if err == nil || uresp.Status != lid.UnlockFailed {
+		t.Fatal("unlock has", uresp, err)
+	}
+	wantState(t, s, map[string]lid.CheckResponse{"a": {Signee: "0"}})
+	if have := s.Stats().Records; have != 1 {
+		t.Fatal("have", have, "records want", 1)
+	}
+
+	s.Close()
+	if _, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil); err != errPersisterClosed {
+		t.Fatal("lock after close has", err)
+	}
+	if _, err = s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil); err != errPersisterClosed {
+		t.Fatal("unlock after close has", err)
+	}
+}
+
+// TestTimeToLive verifies a record past its time to live is treated as
+// absent, unlike a record that has only expired.
+func TestTimeToLive(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	s, err := NewService(lid.ServiceOpts{Duration: time.Second * 10, TimeToLive: time.Minute, Clock: clock})
+	lid.MustErr(err)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Hour})
+
+	clock.Advance(time.Minute * 2)
+	wantState(t, s, map[string]lid.CheckResponse{"b": {Signee: "0"}})
+	resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("expected a new lock but have", resp.Status, err)
+	}
+	resp, err = s.Lock(lid.LockRequest{Signature: "b", Signee: "1"}, nil)
+	if err != nil || resp.Status != lid.LockTransferred {
+		t.Fatal("expected an expired lock but have", resp.Status, err)
+	}
+	clock.Advance(time.Minute * 2)
+	uresp, err := s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "1"}, nil)
+	if err != nil || uresp.Status != lid.UnlockNoLock {
+		t.Fatal("expected no lock but have", uresp.Status, err)
+	}
+}
+
+// TestSweep verifies the sweep reclaims records past their time to
+// live, but keeps expired records without one, and Close stops it.
+func TestSweep(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	s, err := NewServiceWithOpts(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock}, MemOpts{SweepInterval: time.Millisecond})
+	lid.MustErr(err)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Second * 15})
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Minute})
+	s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil)
+
+	clock.Advance(time.Second * 20)
+	waitForStats(t, s, Stats{Records: 2, Reclaimed: 1})
+	clock.Advance(time.Minute)
+	waitForStats(t, s, Stats{Records: 1, Reclaimed: 2})
+	lid.MustErr(s.Close())
+	resp, err := s.Lock(lid.LockRequest{Signature: "c", Signee: "1"}, nil)
+	if err != nil || resp != (lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: "0"}) {
+		t.Fatal("expected the expired lock to transfer but have", resp, err)
+	}
+}
+
+// TestMaxRecords verifies new records past the limit fail
+// until records past their time to live can be reclaimed.
+func TestMaxRecords(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	opts := lid.ServiceOpts{Duration: time.Second * 10, TimeToLive: time.Second * 15, Clock: clock}
+	s, err := NewServiceWithOpts(opts, MemOpts{MaxRecords: 2})
+	lid.MustErr(err)
+	defer s.Close()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	if _, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil); err != ErrTooManyRecords {
+		t.Fatal("expected too many records but have", err)
+	}
+	// Existing records can still change.
+	if _, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil); err != nil {
+		t.Fatal("expected a renewal but have", err)
+	}
+	clock.Advance(time.Second * 20)
+	if _, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil); err != nil {
+		t.Fatal("expected a reclaim but have", err)
+	}
+	if stats := s.Stats(); stats != (Stats{Records: 1, Reclaimed: 2}) {
+		t.Fatal("expected the records reclaimed but have", stats)
+	}
+}
+
+// TestMaxRecordsWithoutTtl verifies that with MaxRecords set, expired
+// records without a time to live are reclaimed, by both the sweep and
+// a new record past the limit.
+func TestMaxRecordsWithoutTtl(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	s, err := NewServiceWithOpts(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock}, MemOpts{MaxRecords: 2})
+	lid.MustErr(err)
+	defer s.Close()
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	clock.Advance(time.Second * 5)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	if _, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil); err != ErrTooManyRecords {
+		t.Fatal("expected too many records but have", err)
+	}
+	// Only a has expired.
+	clock.Advance(time.Second * 6)
+	if _, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil); err != nil {
+		t.Fatal("expected a reclaim but have", err)
+	}
+	if stats := s.Stats(); stats != (Stats{Records: 2, Reclaimed: 1}) {
+		t.Fatal("expected the expired record reclaimed but have", stats)
+	}
+	clock.Advance(time.Second * 20)
+	s.(*memService).Sweep()
+	if stats := s.Stats(); stats != (Stats{Records: 0, Reclaimed: 3}) {
+		t.Fatal("expected the sweep to reclaim every record but have", stats)
+	}
+}
+
+func waitForStats(t *testing.T, s Service, want Stats) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats() != want {
+		if time.Now().After(deadline) {
+			t.Fatal("expected stats", want, "but have", s.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func wantState(t *testing.T, s lid.Service, want map[string]lid.CheckResponse) {
+	for _, sig := range []string{"a", "b", "c"} {
+		have, err := s.Check(sig)
+		if w, ok := want[sig]; ok && (err != nil || have != w) {
+			t.Fatal("expected", sig, w, "but have", have, err)
+		} else if !ok && err != lid.ErrNotFound {
+			t.Fatal("expected no", sig, "but have", have, err)
+		}
+	}
+}
+
 // ------------------------------------------------------------
 // SERVICE DEBUG
 
+func (s *memService) Sweep() {
+	defer lockChange(s.persist).Unlock()
+	s.sweep()
+}
+
 func (s *memService) SetDuration(d time.Duration) {
 	s.opts.Duration = d
 }
 
+func (s *memService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
 // ------------------------------------------------------------
 // TEST-CFG
 
 type memServiceBootstrap struct {
-	service lid.Service
+	service    lid.Service
+	middleware lid.Middleware
+	url        string // Optional. Construct the service with lid.Open()
+	t          *testing.T
+	persist    bool // Optional. Persist to a snapshot and log, which requires t
 }
 
 func (b *memServiceBootstrap) OpenService() lid.Service {
 	opts := lid.ServiceOpts{Duration: time.Second * 10}
 	service, err := NewService(opts)
+	if b.url != "" {
+		service, err = lid.Open(b.url)
+	} else if b.persist {
+		dir := b.t.TempDir()
+		service, err = NewServiceWithOpts(opts, MemOpts{SnapshotPath: filepath.Join(dir, "snapshot.json"), WalPath: filepath.Join(dir, "wal.log")})
+	}
 	lid.MustErr(err)
+	if b.middleware != nil {
+		service = b.middleware(service)
+	}
 	b.service = service
 	return service
 }
 
 func (b *memServiceBootstrap) CloseService() error {
+	var err error
+	if s, ok := lid.Unwrap(b.service).(Service); ok {
+		err = s.Close()
+	}
 	b.service = nil
-	return nil
+	return err
 }
 
 // makeTestServices makes the test services for the testing configuration.
@@ -47,5 +342,14 @@ func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
 	var services []lid.ServiceBootstrap
 	bootstrap := &memServiceBootstrap{}
 	services = append(services, bootstrap)
+	// Run the suite through a middleware chain, which must preserve ServiceDebug and ServiceClockDebug.
+	logger := log.New(ioutil.Discard, "", 0)
+	chained := &memServiceBootstrap{middleware: lid.Chain(lid.WithValidation(), lid.WithLogging(logger))}
+	services = append(services, chained)
+	// Run the suite on a service from the registry.
+	opened := &memServiceBootstrap{url: "mem://?duration=10s"}
+	services = append(services, opened)
+	persisted := &memServiceBootstrap{t: t, persist: true}
+	services = append(services, persisted)
 	return services
 }
@@ -0,0 +1,352 @@
+package lidmem
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/micro-go/lock"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// MEM-OPTS
+
+// MemOpts provides the options for persisting and bounding the mem service.
+type MemOpts struct {
+	// SnapshotPath, if set, is the file the records are written to on
+	// Snapshot and Close, and restored from at construction.
+	SnapshotPath string
+	// SnapshotInterval, if set, also writes a snapshot at every interval.
+	SnapshotInterval time.Duration
+	// WalPath, if set, is a write-ahead log of every change since the
+	// last snapshot, replayed after the snapshot at construction.
+	// Requires a SnapshotPath.
+	WalPath string
+	// WalSync syncs the log to disk after every change. Without it, the
+	// log survives a process restart but may not survive a power loss.
+	// Changes that log at the same time share a sync.
+	WalSync bool
+	// SweepInterval, if set, deletes reclaimable records at every interval.
+	SweepInterval time.Duration
+	// MaxRecords, if set, limits the records held. A lock that would
+	// create a record beyond the limit first reclaims, then fails with
+	// ErrTooManyRecords. Records past their TimeToLive are reclaimed, as
+	// are expired records without one.
+	MaxRecords int
+}
+
+// ------------------------------------------------------------
+// PERSISTER
+
+// persister writes the snapshots and log of a mem service. Every change
+// to the service holds a read lock on my mutex while it writes the log
+// and changes the records, and a snapshot holds the write lock, so the
+// log never misses a change made after a snapshot. A change is logged
+// under its record's mutex before it's applied, so the log has the
+// changes to a record in order, and a change that fails to log isn't made.
+type persister struct {
+	opts  MemOpts
+	mutex sync.RWMutex
+
+	walMutex sync.Mutex // Guards the fields below.
+	wal      *os.File
+	written  int64 // The entries written to the log.
+	closed   bool
+
+	syncMutex sync.Mutex
+	synced    int64 // The entries synced to disk. Guarded by syncMutex.
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+// snapshotFile is the contents of a snapshot.
+type snapshotFile struct {
+	Version int             `json:"version"`
+	Time    time.Time       `json:"time"`
+	Records []MachineRecord `json:"records"`
+}
+
+// walEntry is a single change in the log: the new state of a
+// record, or its deletion.
+type walEntry struct {
+	Op     string        `json:"op"`
+	Record MachineRecord `json:"record"`
+}
+
+func newPersister(opts MemOpts) (*persister, error) {
+	if opts.SnapshotPath == "" {
+		if opts.WalPath != "" || opts.SnapshotInterval != 0 {
+			return nil, errSnapshotPathRequired
+		}
+		return nil, nil
+	}
+	return &persister{opts: opts, done: make(chan struct{})}, nil
+}
+
+// restore() answers the records from the snapshot and log, then
+// opens the log for writing.
+func (p *persister) restore() ([]MachineRecord, error) {
+	records, err := readSnapshot(p.opts.SnapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.WalPath == "" {
+		return records, nil
+	}
+	records, err = replayWal(p.opts.WalPath, records)
+	if err != nil {
+		return nil, err
+	}
+	p.wal, err = os.OpenFile(p.opts.WalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	return records, err
+}
+
+// start() writes a snapshot at every interval until I'm closed.
+func (p *persister) start(snapshot func() error) {
+	if p.opts.SnapshotInterval <= 0 {
+		return
+	}
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(p.opts.SnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				snapshot()
+			}
+		}
+	}()
+}
+
+// logLock() logs the new state of a record. The caller holds a read
+// lock on my mutex, and the record's mutex.
+func (p *persister) logLock(r MachineRecord) error {
+	return p.log(walEntry{Op: walLock, Record: r})
+}
+
+// logUnlock() logs the deletion of a record. The caller holds a read
+// lock on my mutex, and the record's mutex.
+func (p *persister) logUnlock(signature string) error {
+	return p.log(walEntry{Op: walUnlock, Record: MachineRecord{Signature: signature}})
+}
+
+func (p *persister) log(e walEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.walMutex.Lock()
+	if p.closed {
+		p.walMutex.Unlock()
+		return errPersisterClosed
+	}
+	if p.wal == nil {
+		p.walMutex.Unlock()
+		return nil
+	}
+	_, err = p.wal.Write(append(b, '\n'))
+	p.written++
+	seq := p.written
+	p.walMutex.Unlock()
+	if err != nil || !p.opts.WalSync {
+		return err
+	}
+	return p.sync(seq)
+}
+
+// sync() syncs the log to disk through entry seq. A sync covers every
+// entry written before it, so concurrent changes share one.
+func (p *persister) sync(seq int64) error {
+	defer lock.Locker(&p.syncMutex).Unlock()
+	if p.synced >= seq {
+		return nil
+	}
+	p.walMutex.Lock()
+	wal, written := p.wal, p.written
+	p.walMutex.Unlock()
+	if wal == nil {
+		return errPersisterClosed
+	}
+	err := wal.Sync()
+	if err == nil {
+		p.synced = written
+	}
+	return err
+}
+
+// write() writes the snapshot, then empties the log it covers.
+// The caller holds my write lock.
+func (p *persister) write(records []MachineRecord, now time.Time) error {
+	b, err := json.Marshal(snapshotFile{Version: snapshotVersion, Time: now, Records: records})
+	if err != nil {
+		return err
+	}
+	err = writeFile(p.opts.SnapshotPath, b)
+	defer lock.Locker(&p.walMutex).Unlock()
+	if err != nil || p.wal == nil {
+		return err
+	}
+	return p.wal.Truncate(0)
+}
+
+// close() stops the interval snapshots. The final snapshot
+// is the caller's.
+func (p *persister) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.stopped.Wait()
+	})
+}
+
+// closeWal() closes the log, after which every change fails to
+// log. The caller holds my write lock.
+func (p *persister) closeWal() error {
+	defer lock.Locker(&p.walMutex).Unlock()
+	p.closed = true
+	if p.wal == nil {
+		return nil
+	}
+	err := p.wal.Close()
+	p.wal = nil
+	return err
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// readSnapshot() answers the records in the snapshot at path,
+// or none if there is no snapshot.
+func readSnapshot(path string) ([]MachineRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	f := snapshotFile{}
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Version != snapshotVersion {
+		return nil, errSnapshotVersion
+	}
+	return f.Records, nil
+}
+
+// replayWal() applies the log at path to the records. A process that
+// stops mid-write leaves a partial last line, which is ignored.
+func replayWal(path string, records []MachineRecord) ([]MachineRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	state := make(map[string]MachineRecord, len(records))
+	var order []string
+	for _, r := range records {
+		state[r.Signature] = r
+		order = append(order, r.Signature)
+	}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		e := walEntry{}
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case walLock:
+			if _, ok := state[e.Record.Signature]; !ok {
+				order = append(order, e.Record.Signature)
+			}
+			state[e.Record.Signature] = e.Record
+		case walUnlock:
+			delete(state, e.Record.Signature)
+		default:
+			return nil, errWalEntry
+		}
+	}
+
+	records = records[:0]
+	for _, sig := range order {
+		if r, ok := state[sig]; ok {
+			records = append(records, r)
+			delete(state, sig)
+		}
+	}
+	return records, nil
+}
+
+// writeFile() atomically replaces the file at path.
+func writeFile(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// lockChange() read locks the persister for a change, if there is one,
+// answering the unlocker.
+func lockChange(p *persister) interface{ Unlock() } {
+	if p == nil {
+		return nopUnlocker{}
+	}
+	return lock.Read(&p.mutex)
+}
+
+// lockPersist() write locks the persister for a snapshot, if there is
+// one, answering the unlocker.
+func lockPersist(p *persister) interface{ Unlock() } {
+	if p == nil {
+		return nopUnlocker{}
+	}
+	return lock.Write(&p.mutex)
+}
+
+type nopUnlocker struct{}
+
+func (nopUnlocker) Unlock() {}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	snapshotVersion = 1
+
+	walLock   = "lock"
+	walUnlock = "unlock"
+)
@@ -1,27 +1,128 @@
 package lidmem
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hackborn/lid"
 	"github.com/micro-go/lock"
+	"io"
+	"net/url"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ------------------------------------------------------------
+// SERVICE
+
+// Service is a lid.Service with the in-memory extras. Close it to
+// stop the sweep and the interval snapshots, and write a final snapshot.
+type Service interface {
+	lid.Service
+	io.Closer
+	// Snapshot writes the records to the snapshot file.
+	Snapshot() error
+	// Stats answers the current state of the service.
+	Stats() Stats
+}
+
+// Stats describes the records of a mem service.
+type Stats struct {
+	Records   int   // The records held, including expired records not yet reclaimed.
+	Reclaimed int64 // The records deleted past their time to live since construction.
+}
+
 // ------------------------------------------------------------
 // MEM-SERVICE
 
 // memService provides an in-memory lid.Service implementation.
+//
+// The records are striped over maps by a hash of the signature, each with
+// its own mutex, so calls on different signatures rarely contend. Renewing
+// a lock only takes a stripe's read lock and the record's mutex, and
+// doesn't allocate.
+//
+// A record is reclaimable once it has outlived its TimeToLive. A record
+// without one is kept after its lock expires, so the next lock reports
+// its previous owner, unless MaxRecords is set, which bounds the records
+// held: then it's reclaimable once its lock expires. Reclaimable records
+// are deleted by the sweep, and when a new record would exceed MaxRecords.
 type memService struct {
 	opts    lid.ServiceOpts
-	mutex   sync.RWMutex
-	records map[string]*record
+	mopts   MemOpts
+	stripes [stripeCount]stripe
+	persist *persister // Optional
+
+	count     int64 // Atomic. The records in every stripe.
+	reclaimed int64 // Atomic
+	closeOnce sync.Once
+	done      chan struct{}
+	swept     sync.WaitGroup
+}
+
+// init() registers the "mem" backend, i.e. mem://?duration=10s
+// The snapshot, wal, snapshot_interval, sweep_interval and max_records
+// parameters set the MemOpts.
+func init() {
+	lid.Register("mem", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		q := u.Query()
+		mopts := MemOpts{SnapshotPath: q.Get(snapshotParam), WalPath: q.Get(walParam)}
+		var err error
+		mopts.SnapshotInterval, err = lid.ParseDurationParam(q, snapshotIntervalParam, err)
+		mopts.SweepInterval, err = lid.ParseDurationParam(q, sweepIntervalParam, err)
+		if v := q.Get(maxRecordsParam); v != "" && err == nil {
+			mopts.MaxRecords, err = strconv.Atoi(v)
+			if err != nil {
+				err = errors.New("Bad request: Invalid " + maxRecordsParam + " (" + v + ")")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewServiceWithOpts(opts, mopts)
+	})
 }
 
 // NewService constructs a new in-memory locking service.
 func NewService(opts lid.ServiceOpts) (lid.Service, error) {
-	records := make(map[string]*record)
-	return &memService{opts: opts, records: records}, nil
+	return NewServiceWithOpts(opts, MemOpts{})
+}
+
+// NewServiceWithOpts constructs a new in-memory locking service that
+// persists its records as the MemOpts describe, restoring any records
+// already persisted. Restored locks keep their original expiry.
+func NewServiceWithOpts(opts lid.ServiceOpts, mopts MemOpts) (Service, error) {
+	s := &memService{opts: opts, mopts: mopts, done: make(chan struct{})}
+	for i := range s.stripes {
+		s.stripes[i].records = make(map[string]*record)
+	}
+	p, err := newPersister(mopts)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		s.startSweep()
+		return s, nil
+	}
+	restored, err := p.restore()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range restored {
+		s.stripe(r.Signature).records[r.Signature] = newRecord(r)
+	}
+	s.count = int64(len(restored))
+	s.persist = p
+	// Start from a fresh snapshot and an empty log.
+	err = s.Snapshot()
+	if err != nil {
+		p.closeWal()
+		return nil, err
+	}
+	p.start(s.Snapshot)
+	s.startSweep()
+	return s, nil
 }
 
 func (s *memService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
@@ -29,25 +130,74 @@ func (s *memService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResp
 		return lid.LockResponse{}, lid.ErrBadRequest
 	}
 
-	endTimeFn := newEndTimeFn(&s.opts, opts)
+	defer lockChange(s.persist).Unlock()
+	resp, r, err := s.lock(req, opts)
+	// The record I found was deleted, or I need room, so look again.
+	for err == errRecordDeleted || err == errReclaimed {
+		if err == errRecordDeleted {
+			// Don't wait on the deleter to remove it from the map.
+			s.delete(req.Signature, r)
+		}
+		resp, r, err = s.lock(req, opts)
+	}
+	return resp, err
+}
+
+func (s *memService) lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, *record, error) {
+	now := s.opts.Now()
+	endTime := s.getEndTime(now, opts)
+	ttl := s.getTtl(now, opts)
+	st := s.stripe(req.Signature)
 
 	// First try a read
-	r := s.find(req.Signature)
+	r := st.find(req.Signature)
 	if r != nil {
-		return r.lock(req, opts, endTimeFn)
+		resp, err := r.lock(req, now, endTime, ttl, s.persist)
+		return resp, r, err
 	}
 
 	// Then a write
-	defer lock.Write(&s.mutex).Unlock()
-	r = s.records[req.Signature]
+	st.mutex.Lock()
+	r = st.records[req.Signature]
 	if r != nil {
-		return r.lock(req, opts, endTimeFn)
+		st.mutex.Unlock()
+		resp, err := r.lock(req, now, endTime, ttl, s.persist)
+		return resp, r, err
 	}
+	if !s.reserve() {
+		st.mutex.Unlock()
+		// Reclaiming takes every stripe, so it can't happen while I hold one.
+		if s.sweep() > 0 {
+			return lid.LockResponse{}, nil, errReclaimed
+		}
+		return lid.LockResponse{}, nil, ErrTooManyRecords
+	}
+	// The new record is held until it's logged, so nothing else sees it first.
+	r = &record{signature: req.Signature, signee: req.Signee, level: req.Level, endTime: endTime, ttl: ttl}
+	r.mutex.Lock()
+	st.records[req.Signature] = r
+	st.mutex.Unlock()
+	if s.persist != nil {
+		if err := s.persist.logLock(r.state()); err != nil {
+			r.deleted = true
+			r.mutex.Unlock()
+			s.delete(req.Signature, r)
+			return lid.LockResponse{Status: lid.LockFailed}, r, err
+		}
+	}
+	r.mutex.Unlock()
+	return lid.LockResponse{Status: lid.LockOk}, r, nil
+}
 
-	endTime := endTimeFn(time.Now())
-	r = &record{signee: req.Signee, level: req.Level, endTime: endTime}
-	s.records[req.Signature] = r
-	return lid.LockResponse{Status: lid.LockOk}, nil
+// reserve() answers true if there's room for a new record,
+// counting it if there is.
+func (s *memService) reserve() bool {
+	n := atomic.AddInt64(&s.count, 1)
+	if s.mopts.MaxRecords > 0 && n > int64(s.mopts.MaxRecords) {
+		atomic.AddInt64(&s.count, -1)
+		return false
+	}
+	return true
 }
 
 func (s *memService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
@@ -55,14 +205,17 @@ func (s *memService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.Un
 		return lid.UnlockResponse{}, lid.ErrBadRequest
 	}
 
-	r := s.find(req.Signature)
+	defer lockChange(s.persist).Unlock()
+	r := s.stripe(req.Signature).find(req.Signature)
 	if r == nil {
 		return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
 	}
-	resp, err := r.unlock(req, opts)
-	if resp.Status != lid.UnlockFailed {
-		defer lock.Write(&s.mutex).Unlock()
-		delete(s.records, req.Signature)
+	// The unlock takes effect when the record is marked deleted, under
+	// its mutex. A lock that finds it after that looks again, so removing
+	// it from the map afterwards can't remove a newer lock.
+	resp, deleted, err := r.unlock(req, s.opts.Now(), s.persist)
+	if deleted {
+		s.delete(req.Signature, r)
 	}
 	return resp, err
 }
@@ -75,85 +228,291 @@ func (s *memService) Check(signature string) (lid.CheckResponse, error) {
 	if signature == "" {
 		return lid.CheckResponse{}, lid.ErrBadRequest
 	}
-	r := s.find(signature)
+	r := s.stripe(signature).find(signature)
 	if r != nil {
-		return r.check(signature)
+		return r.check(s.opts.Now())
 	}
 	return lid.CheckResponse{}, lid.ErrNotFound
 }
 
-func (s *memService) find(signature string) *record {
-	defer lock.Read(&s.mutex).Unlock()
-	r, _ := s.records[signature]
+// Snapshot() writes my records to the snapshot file, and empties
+// the write-ahead log.
+func (s *memService) Snapshot() error {
+	if s.persist == nil {
+		return errSnapshotPathRequired
+	}
+	defer lockPersist(s.persist).Unlock()
+	return s.persist.write(s.machineRecords(), s.opts.Now())
+}
+
+// Stats() answers my current state.
+func (s *memService) Stats() Stats {
+	return Stats{Records: int(atomic.LoadInt64(&s.count)), Reclaimed: atomic.LoadInt64(&s.reclaimed)}
+}
+
+// Close() stops the sweep and the interval snapshots, and
+// writes a final snapshot.
+func (s *memService) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.swept.Wait()
+	})
+	if s.persist == nil {
+		return nil
+	}
+	s.persist.close()
+	defer lockPersist(s.persist).Unlock()
+	err := s.persist.write(s.machineRecords(), s.opts.Now())
+	return lid.MergeErr(err, s.persist.closeWal())
+}
+
+func (s *memService) machineRecords() []MachineRecord {
+	records := make([]MachineRecord, 0, atomic.LoadInt64(&s.count))
+	for i := range s.stripes {
+		records = s.stripes[i].machineRecords(records)
+	}
+	return records
+}
+
+// delete() deletes the record, unless it has already been replaced.
+func (s *memService) delete(signature string, r *record) {
+	if s.stripe(signature).delete(signature, r) {
+		atomic.AddInt64(&s.count, -1)
+	}
+}
+
+// startSweep() sweeps at every interval until I'm closed.
+func (s *memService) startSweep() {
+	if s.mopts.SweepInterval <= 0 {
+		return
+	}
+	s.swept.Add(1)
+	go func() {
+		defer s.swept.Done()
+		ticker := time.NewTicker(s.mopts.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				func() {
+					defer lockChange(s.persist).Unlock()
+					s.sweep()
+				}()
+			}
+		}
+	}()
+}
+
+// sweep() deletes every reclaimable record, answering how many.
+// Lock calls this while holding the persister's read lock, so the
+// interval sweep takes it, and I don't.
+func (s *memService) sweep() int64 {
+	now := s.opts.Now()
+	bounded := s.mopts.MaxRecords > 0
+	var n int64
+	for i := range s.stripes {
+		n += s.stripes[i].reclaim(now, bounded, s.persist)
+	}
+	atomic.AddInt64(&s.count, -n)
+	atomic.AddInt64(&s.reclaimed, n)
+	return n
+}
+
+// getEndTime() answers the time a lock taken now expires.
+func (s *memService) getEndTime(now time.Time, opts *lid.LockOpts) time.Time {
+	if opts != nil && opts.Duration != emptyDuration {
+		return now.Add(opts.Duration)
+	}
+	return now.Add(s.opts.Duration)
+}
+
+// getTtl() answers the time a new or changed record may be
+// reclaimed, or zero if it has no time to live.
+func (s *memService) getTtl(now time.Time, opts *lid.LockOpts) time.Time {
+	if opts != nil && opts.TimeToLive != emptyDuration {
+		return now.Add(opts.TimeToLive)
+	}
+	if s.opts.TimeToLive != emptyDuration {
+		return now.Add(s.opts.TimeToLive)
+	}
+	return time.Time{}
+}
+
+// stripe() answers the stripe that holds the signature.
+func (s *memService) stripe(signature string) *stripe {
+	// FNV-1a, inline so it doesn't allocate.
+	h := uint32(2166136261)
+	for i := 0; i < len(signature); i++ {
+		h ^= uint32(signature[i])
+		h *= 16777619
+	}
+	return &s.stripes[h%stripeCount]
+}
+
+// ------------------------------------------------------------
+// STRIPE
+
+// stripe is one of the maps of records.
+type stripe struct {
+	mutex   sync.RWMutex
+	records map[string]*record
+}
+
+func (s *stripe) find(signature string) *record {
+	s.mutex.RLock()
+	r := s.records[signature]
+	s.mutex.RUnlock()
 	return r
 }
 
+// delete() deletes the record, unless it has already been replaced,
+// answering true if it was deleted.
+func (s *stripe) delete(signature string, r *record) bool {
+	defer lock.Write(&s.mutex).Unlock()
+	if s.records[signature] == r {
+		delete(s.records, signature)
+		return true
+	}
+	return false
+}
+
+// reclaim() deletes every reclaimable record, answering how many.
+// A record whose deletion fails to log is left for the next sweep.
+// The caller holds the persister's read lock.
+func (s *stripe) reclaim(now time.Time, bounded bool, p *persister) int64 {
+	defer lock.Write(&s.mutex).Unlock()
+	var n int64
+	for sig, r := range s.records {
+		if r.reclaim(now, bounded, p) {
+			delete(s.records, sig)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *stripe) machineRecords(records []MachineRecord) []MachineRecord {
+	defer lock.Read(&s.mutex).Unlock()
+	for _, r := range s.records {
+		records = append(records, r.machineRecord())
+	}
+	return records
+}
+
 // ------------------------------------------------------------
 // RECORD
 
+// record is a single lock. A change to a record is logged, if there's
+// a persister, under my mutex and before it's applied, so a change that
+// fails to log isn't made. Without a persister nothing is logged, and
+// nothing allocates.
 type record struct {
-	mutex   sync.Mutex
-	signee  string
-	level   int
-	endTime time.Time
+	mutex     sync.Mutex
+	signature string
+	signee    string
+	level     int
+	endTime   time.Time
+	ttl       time.Time // When the record may be reclaimed, if not zero.
+	deleted   bool      // The record has left the map, so it can't be changed.
 }
 
-func (r *record) lock(req lid.LockRequest, opts *lid.LockOpts, endTimeFn TimeFunc) (lid.LockResponse, error) {
-	now := time.Now()
-	endTime := endTimeFn(now)
+func newRecord(r MachineRecord) *record {
+	return &record{signature: r.Signature, signee: r.Signee, level: r.Level, endTime: r.EndTime, ttl: r.TimeToLive}
+}
+
+func (r *record) lock(req lid.LockRequest, now, endTime, ttl time.Time, p *persister) (lid.LockResponse, error) {
 	defer lock.Locker(&r.mutex).Unlock()
-	if req.Signee == r.signee {
-		r.level = req.Level
-		r.endTime = endTime
-		return lid.LockResponse{Status: lid.LockRenewed}, nil
+	if r.deleted {
+		return lid.LockResponse{}, errRecordDeleted
 	}
-	if req.Level > r.level {
-		prev := r.signee
-		r.signee = req.Signee
-		r.level = req.Level
-		r.endTime = endTime
-		return lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: prev}, nil
+	var resp lid.LockResponse
+	switch {
+	// A record past its time to live is treated as absent.
+	case r.outlived(now):
+		resp = lid.LockResponse{Status: lid.LockOk}
+	case req.Signee == r.signee:
+		resp = lid.LockResponse{Status: lid.LockRenewed}
+	case req.Level > r.level, now.After(r.endTime):
+		resp = lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: r.signee}
+	default:
+		return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
 	}
-	if now.After(r.endTime) {
-		prev := r.signee
-		r.signee = req.Signee
-		r.level = req.Level
-		r.endTime = endTime
-		return lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: prev}, nil
+	if p != nil {
+		next := MachineRecord{Signature: r.signature, Signee: req.Signee, Level: req.Level, EndTime: endTime, TimeToLive: ttl}
+		if err := p.logLock(next); err != nil {
+			return lid.LockResponse{Status: lid.LockFailed}, err
+		}
 	}
-	return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
+	r.signee = req.Signee
+	r.level = req.Level
+	r.endTime = endTime
+	r.ttl = ttl
+	return resp, nil
 }
 
-func (r *record) unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
-	if r.signee != req.Signee {
-		return lid.UnlockResponse{}, lid.ErrForbidden
+// unlock() marks the record deleted if the unlock succeeds, answering
+// true if this call deleted it. The caller removes it from the map.
+func (r *record) unlock(req lid.UnlockRequest, now time.Time, p *persister) (lid.UnlockResponse, bool, error) {
+	defer lock.Locker(&r.mutex).Unlock()
+	if r.deleted {
+		return lid.UnlockResponse{Status: lid.UnlockNoLock}, false, nil
 	}
-	return lid.UnlockResponse{Status: lid.UnlockOk}, nil
+	resp := lid.UnlockResponse{Status: lid.UnlockOk}
+	if r.outlived(now) {
+		resp.Status = lid.UnlockNoLock
+	} else if r.signee != req.Signee {
+		return lid.UnlockResponse{}, false, lid.ErrForbidden
+	}
+	if p != nil {
+		if err := p.logUnlock(r.signature); err != nil {
+			return lid.UnlockResponse{Status: lid.UnlockFailed}, false, err
+		}
+	}
+	r.deleted = true
+	return resp, true, nil
 }
 
-func (r *record) check(signature string) (lid.CheckResponse, error) {
+// reclaim() marks the record deleted if it's reclaimable and its
+// deletion is logged, answering true if it is. When bounded, a record
+// without a time to live is reclaimable once its lock expires. The
+// caller removes it from the map.
+func (r *record) reclaim(now time.Time, bounded bool, p *persister) bool {
 	defer lock.Locker(&r.mutex).Unlock()
-	return lid.CheckResponse{r.signee, r.level}, nil
+	expired := bounded && r.ttl.IsZero() && now.After(r.endTime)
+	if !expired && !r.outlived(now) {
+		return false
+	}
+	if p != nil && p.logUnlock(r.signature) != nil {
+		return false
+	}
+	r.deleted = true
+	return true
 }
 
-// ------------------------------------------------------------
-// FUNC
+// outlived() answers true if the record is past its time to live.
+// The caller holds my mutex.
+func (r *record) outlived(now time.Time) bool {
+	return !r.ttl.IsZero() && now.After(r.ttl)
+}
 
-// TimeFunc converts one time to another
-type TimeFunc func(time.Time) time.Time
+func (r *record) machineRecord() MachineRecord {
+	defer lock.Locker(&r.mutex).Unlock()
+	return r.state()
+}
 
-// newEndTimeFn() answers a new TimeFunc that gets the current
-// end time after applying all my options.
-func newEndTimeFn(opts1 *lid.ServiceOpts, opts2 *lid.LockOpts) TimeFunc {
-	return func(t time.Time) time.Time {
-		if opts2 != nil && opts2.Duration != emptyDuration {
-			return t.Add(opts2.Duration)
-		}
-		if opts1 != nil && opts1.Duration != emptyDuration {
-			return t.Add(opts1.Duration)
-		}
-		return t
+// state() answers my MachineRecord. The caller holds my mutex.
+func (r *record) state() MachineRecord {
+	return MachineRecord{Signature: r.signature, Signee: r.signee, Level: r.level, EndTime: r.endTime, TimeToLive: r.ttl}
+}
+
+func (r *record) check(now time.Time) (lid.CheckResponse, error) {
+	defer lock.Locker(&r.mutex).Unlock()
+	if r.deleted || r.outlived(now) {
+		return lid.CheckResponse{}, lid.ErrNotFound
 	}
+	return lid.CheckResponse{r.signee, r.level}, nil
 }
 
 // ------------------------------------------------------------
@@ -166,6 +525,17 @@ func serviceFmt() {
 // ------------------------------------------------------------
 // CONST and VAR
 
+const (
+	// The number of stripes of records. A power of 2, to spread the hash evenly.
+	stripeCount = 64
+
+	maxRecordsParam       = "max_records"
+	snapshotParam         = "snapshot"
+	snapshotIntervalParam = "snapshot_interval"
+	sweepIntervalParam    = "sweep_interval"
+	walParam              = "wal"
+)
+
 var (
 	emptyDuration = time.Second * 0
 )
@@ -0,0 +1,438 @@
+package lid
+
+import (
+	"container/list"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/micro-go/lock"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// METRICS
+
+// Metrics receives the measurements taken by the metrics middleware.
+type Metrics interface {
+	// Count increments the counter for an operation on a backend
+	// that finished with the given status.
+	Count(backend, op, status string)
+	// Latency records the time an operation on a backend took.
+	Latency(backend, op string, d time.Duration)
+	// Hold records the time a lock was held, from acquire to release.
+	Hold(backend string, d time.Duration)
+}
+
+// MetricsOpts provides options for the metrics middleware.
+type MetricsOpts struct {
+	// Backend labels every measurement.
+	Backend string
+	// Duration is the lock duration of the service, which ends a hold
+	// that isn't released. LockOpts.Duration overrides it. Without
+	// either, a hold only ends when the lock is released or taken.
+	Duration time.Duration
+	// MaxHolds limits the holds tracked at once. Past it, the hold
+	// acquired or renewed longest ago is dropped unreported.
+	// Defaults to 10000.
+	MaxHolds int
+}
+
+// WithMetrics answers a middleware that reports every call to m,
+// labelled with the backend name. duration is the lock duration of the
+// service, which ends a hold that isn't released; see MetricsOpts.
+func WithMetrics(m Metrics, backend string, duration time.Duration) Middleware {
+	return WithMetricsOpts(m, MetricsOpts{Backend: backend, Duration: duration})
+}
+
+// WithMetricsOpts answers a middleware that reports every call to m.
+func WithMetricsOpts(m Metrics, opts MetricsOpts) Middleware {
+	if opts.MaxHolds < 1 {
+		opts.MaxHolds = defaultMaxHolds
+	}
+	return func(next Service) Service {
+		s := &metricsService{next: next, metrics: m, opts: opts, backend: opts.Backend, holds: make(map[string]*list.Element), order: list.New()}
+		return preserve(s, next)
+	}
+}
+
+// metricsService reports every call to its Metrics. The holds are
+// ordered by when they were last acquired or renewed, so the oldest,
+// and with a single duration the expired, are found at the back.
+type metricsService struct {
+	next    Service
+	metrics Metrics
+	opts    MetricsOpts
+	backend string
+
+	mutex sync.Mutex
+	holds map[string]*list.Element // Signature to *metricsHold in order
+	order *list.List
+}
+
+// metricsHold tracks when the current owner acquired a lock,
+// and when it expires if that's known.
+type metricsHold struct {
+	signature string
+	signee    string
+	start     time.Time
+	expires   time.Time
+}
+
+// end() answers the time the hold ended, if it ended by t.
+func (h *metricsHold) end(t time.Time) time.Time {
+	if !h.expires.IsZero() && h.expires.Before(t) {
+		return h.expires
+	}
+	return t
+}
+
+func (s *metricsService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Lock(req, opts)
+	end := time.Now()
+	s.metrics.Latency(s.backend, lockOp, end.Sub(start))
+	s.metrics.Count(s.backend, lockOp, metricsStatus(resp.Status, err))
+	if err == nil && resp.Ok() {
+		s.acquired(req, opts, end)
+	}
+	return resp, err
+}
+
+// acquired notes that the requester now owns the lock, ending any
+// hold I was tracking for the previous owner, and ends every hold
+// that has expired.
+func (s *metricsService) acquired(req LockRequest, opts *LockOpts, t time.Time) {
+	defer lock.Locker(&s.mutex).Unlock()
+	s.expire(t)
+	var expires time.Time
+	if d := s.getDuration(opts); d > 0 {
+		expires = t.Add(d)
+	}
+	if e, ok := s.holds[req.Signature]; ok {
+		prev := e.Value.(*metricsHold)
+		if prev.signee == req.Signee {
+			// A renewal continues the hold.
+			prev.expires = expires
+			s.order.MoveToFront(e)
+			return
+		}
+		s.metrics.Hold(s.backend, prev.end(t).Sub(prev.start))
+		s.remove(e)
+	}
+	h := &metricsHold{signature: req.Signature, signee: req.Signee, start: t, expires: expires}
+	s.holds[req.Signature] = s.order.PushFront(h)
+	for s.order.Len() > s.opts.MaxHolds {
+		s.remove(s.order.Back())
+	}
+}
+
+// expire() ends the holds that expired by t. The caller holds my mutex.
+func (s *metricsService) expire(t time.Time) {
+	for e := s.order.Back(); e != nil; e = s.order.Back() {
+		h := e.Value.(*metricsHold)
+		if h.expires.IsZero() || !h.expires.Before(t) {
+			return
+		}
+		s.metrics.Hold(s.backend, h.expires.Sub(h.start))
+		s.remove(e)
+	}
+}
+
+// remove() stops tracking the hold. The caller holds my mutex.
+func (s *metricsService) remove(e *list.Element) {
+	delete(s.holds, e.Value.(*metricsHold).signature)
+	s.order.Remove(e)
+}
+
+func (s *metricsService) getDuration(opts *LockOpts) time.Duration {
+	if opts != nil && opts.Duration > 0 {
+		return opts.Duration
+	}
+	return s.opts.Duration
+}
+
+func (s *metricsService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Unlock(req, opts)
+	end := time.Now()
+	s.metrics.Latency(s.backend, unlockOp, end.Sub(start))
+	s.metrics.Count(s.backend, unlockOp, metricsStatus(resp.Status, err))
+	if err == nil && resp.Status == UnlockOk {
+		s.released(req, end)
+	}
+	return resp, err
+}
+
+// released ends the hold on the lock.
+func (s *metricsService) released(req UnlockRequest, t time.Time) {
+	defer lock.Locker(&s.mutex).Unlock()
+	if e, ok := s.holds[req.Signature]; ok {
+		if prev := e.Value.(*metricsHold); prev.signee == req.Signee {
+			s.metrics.Hold(s.backend, prev.end(t).Sub(prev.start))
+			s.remove(e)
+		}
+	}
+}
+
+func (s *metricsService) Check(signature string) (CheckResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Check(signature)
+	s.metrics.Latency(s.backend, checkOp, time.Since(start))
+	status := "Ok"
+	if err == ErrNotFound {
+		status = "NotFound"
+	} else if err != nil {
+		status = errorStatus
+	}
+	s.metrics.Count(s.backend, checkOp, status)
+	return resp, err
+}
+
+func (s *metricsService) Unwrap() Service {
+	return s.next
+}
+
+// metricsStatus answers the counter label for a response status.
+// Errors other than ErrForbidden are not a status of the lock, so
+// they are counted separately.
+func metricsStatus(status fmt.Stringer, err error) string {
+	if err != nil && err != ErrForbidden {
+		return errorStatus
+	}
+	return status.String()
+}
+
+// ------------------------------------------------------------
+// EXPVAR-METRICS
+
+// ExpvarMetrics is a Metrics implementation that keeps its values
+// in memory. It is an expvar.Var, and can write itself in the
+// Prometheus text format.
+type ExpvarMetrics struct {
+	mutex   sync.Mutex
+	counts  map[metricsKey]int64
+	latency map[metricsKey]*histogram
+	hold    map[metricsKey]*histogram
+}
+
+// NewExpvarMetrics answers a new ExpvarMetrics. If name is not empty
+// the metrics are published to expvar under that name; like
+// expvar.Publish, this panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		counts:  make(map[metricsKey]int64),
+		latency: make(map[metricsKey]*histogram),
+		hold:    make(map[metricsKey]*histogram),
+	}
+	if name != "" {
+		expvar.Publish(name, m)
+	}
+	return m
+}
+
+func (m *ExpvarMetrics) Count(backend, op, status string) {
+	defer lock.Locker(&m.mutex).Unlock()
+	m.counts[metricsKey{backend, op, status}]++
+}
+
+func (m *ExpvarMetrics) Latency(backend, op string, d time.Duration) {
+	defer lock.Locker(&m.mutex).Unlock()
+	observe(m.latency, metricsKey{backend: backend, op: op}, latencyBuckets, d)
+}
+
+func (m *ExpvarMetrics) Hold(backend string, d time.Duration) {
+	defer lock.Locker(&m.mutex).Unlock()
+	observe(m.hold, metricsKey{backend: backend}, holdBuckets, d)
+}
+
+// String answers the metrics as JSON, satisfying expvar.Var.
+func (m *ExpvarMetrics) String() string {
+	defer lock.Locker(&m.mutex).Unlock()
+	type hist struct {
+		Count   int64            `json:"count"`
+		Sum     float64          `json:"sum"`
+		Buckets map[string]int64 `json:"buckets"`
+	}
+	toHist := func(h *histogram) hist {
+		buckets := make(map[string]int64)
+		var total int64
+		for i, le := range h.bounds {
+			total += h.counts[i]
+			buckets[formatFloat(le)] = total
+		}
+		return hist{h.count, h.sum, buckets}
+	}
+	v := struct {
+		Operations map[string]int64 `json:"operations"`
+		Latency    map[string]hist  `json:"latency"`
+		Hold       map[string]hist  `json:"hold"`
+	}{make(map[string]int64), make(map[string]hist), make(map[string]hist)}
+	for k, c := range m.counts {
+		v.Operations[k.backend+"/"+k.op+"/"+k.status] = c
+	}
+	for k, h := range m.latency {
+		v.Latency[k.backend+"/"+k.op] = toHist(h)
+	}
+	for k, h := range m.hold {
+		v.Hold[k.backend] = toHist(h)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (m *ExpvarMetrics) WritePrometheus(w io.Writer) error {
+	defer lock.Locker(&m.mutex).Unlock()
+	var b strings.Builder
+
+	b.WriteString("# HELP lid_operations_total Lock service operations by backend, operation and status.\n")
+	b.WriteString("# TYPE lid_operations_total counter\n")
+	for _, k := range sortedKeys(m.counts) {
+		labels := promLabels("backend", k.backend, "op", k.op, "status", k.status)
+		fmt.Fprintf(&b, "lid_operations_total{%v} %d\n", labels, m.counts[k])
+	}
+
+	b.WriteString("# HELP lid_operation_duration_seconds Lock service operation latency by backend and operation.\n")
+	b.WriteString("# TYPE lid_operation_duration_seconds histogram\n")
+	for _, k := range sortedHistogramKeys(m.latency) {
+		labels := promLabels("backend", k.backend, "op", k.op)
+		m.latency[k].writePrometheus(&b, "lid_operation_duration_seconds", labels)
+	}
+
+	b.WriteString("# HELP lid_hold_duration_seconds Time locks were held from acquire to release, by backend.\n")
+	b.WriteString("# TYPE lid_hold_duration_seconds histogram\n")
+	for _, k := range sortedHistogramKeys(m.hold) {
+		labels := promLabels("backend", k.backend)
+		m.hold[k].writePrometheus(&b, "lid_hold_duration_seconds", labels)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// NewPrometheusHandler answers an http.Handler that serves the
+// metrics in the Prometheus text format, for local scraping.
+func NewPrometheusHandler(m *ExpvarMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.WritePrometheus(w)
+	})
+}
+
+// ------------------------------------------------------------
+// HISTOGRAM
+
+// histogram is a fixed-bucket histogram of durations in seconds.
+type histogram struct {
+	bounds []float64
+	counts []int64 // Per bucket, not cumulative. The last entry is +Inf.
+	count  int64
+	sum    float64
+}
+
+func observe(dst map[metricsKey]*histogram, k metricsKey, bounds []float64, d time.Duration) {
+	h := dst[k]
+	if h == nil {
+		h = &histogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+		dst[k] = h
+	}
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) writePrometheus(b *strings.Builder, name, labels string) {
+	var total int64
+	for i, le := range h.bounds {
+		total += h.counts[i]
+		fmt.Fprintf(b, "%v_bucket{%v,le=\"%v\"} %d\n", name, labels, formatFloat(le), total)
+	}
+	fmt.Fprintf(b, "%v_bucket{%v,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(b, "%v_sum{%v} %v\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(b, "%v_count{%v} %d\n", name, labels, h.count)
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+type metricsKey struct {
+	backend string
+	op      string
+	status  string
+}
+
+func (a metricsKey) less(b metricsKey) bool {
+	if a.backend != b.backend {
+		return a.backend < b.backend
+	}
+	if a.op != b.op {
+		return a.op < b.op
+	}
+	return a.status < b.status
+}
+
+func sortedKeys(m map[metricsKey]int64) []metricsKey {
+	keys := make([]metricsKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	return keys
+}
+
+func sortedHistogramKeys(m map[metricsKey]*histogram) []metricsKey {
+	keys := make([]metricsKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	return keys
+}
+
+// promLabels answers the name/value pairs formatted as Prometheus labels.
+func promLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(pairs[i] + `="` + promEscaper.Replace(pairs[i+1]) + `"`)
+	}
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%g", f)
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultMaxHolds = 10000
+
+	lockOp   = "lock"
+	unlockOp = "unlock"
+	checkOp  = "check"
+
+	errorStatus = "Error"
+)
+
+var (
+	// Latency buckets, in seconds.
+	latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// Hold buckets, in seconds.
+	holdBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+	promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
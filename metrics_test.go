@@ -0,0 +1,87 @@
+package lid_test
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetrics runs a few operations through the metrics middleware
+// and verifies the exported counters.
+func TestMetrics(t *testing.T) {
+	m := lid.NewExpvarMetrics("")
+	s, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	s = lid.WithMetrics(m, "mem", time.Second*10)(s)
+
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1", Level: 1}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "1"}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "1"}, nil)
+	s.Check("a")
+
+	var b strings.Builder
+	lid.MustErr(m.WritePrometheus(&b))
+	have := b.String()
+	want := []string{
+		`lid_operations_total{backend="mem",op="check",status="NotFound"} 1`,
+		`lid_operations_total{backend="mem",op="lock",status="LockFailed"} 1`,
+		`lid_operations_total{backend="mem",op="lock",status="LockOk"} 1`,
+		`lid_operations_total{backend="mem",op="lock",status="LockRenewed"} 1`,
+		`lid_operations_total{backend="mem",op="lock",status="LockTransferred"} 1`,
+		`lid_operations_total{backend="mem",op="unlock",status="UnlockNoLock"} 1`,
+		`lid_operations_total{backend="mem",op="unlock",status="UnlockOk"} 1`,
+		`lid_operation_duration_seconds_count{backend="mem",op="lock"} 4`,
+		`lid_hold_duration_seconds_count{backend="mem"} 2`,
+	}
+	for _, w := range want {
+		if !strings.Contains(have, w) {
+			t.Fatal("missing", w, "in\n", have)
+		}
+	}
+	if !strings.Contains(m.String(), `"mem/lock/LockOk":1`) {
+		t.Fatal("missing expvar counter in", m.String())
+	}
+}
+
+// TestMetricsHolds verifies a hold ends when its lock expires, and
+// that the holds tracked are bounded.
+func TestMetricsHolds(t *testing.T) {
+	m := &holdMetrics{}
+	s, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	s = lid.WithMetricsOpts(m, lid.MetricsOpts{Backend: "mem", Duration: time.Hour, MaxHolds: 2})(s)
+
+	// The expired hold ends at its expiry, when the next lock is taken.
+	short := &lid.LockOpts{Duration: 20 * time.Millisecond}
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, short)
+	time.Sleep(50 * time.Millisecond)
+	s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	if len(m.holds) != 1 || m.holds[0] != 20*time.Millisecond {
+		t.Fatal("have", m.holds, "want [20ms]")
+	}
+
+	// Past MaxHolds the oldest hold is dropped, so its release isn't reported.
+	s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil)
+	s.Lock(lid.LockRequest{Signature: "d", Signee: "0"}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "b", Signee: "0"}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "d", Signee: "0"}, nil)
+	if len(m.holds) != 2 {
+		t.Fatal("have", m.holds, "want 2 holds")
+	}
+}
+
+// holdMetrics records the holds.
+type holdMetrics struct {
+	holds []time.Duration
+}
+
+func (m *holdMetrics) Count(backend, op, status string)            {}
+func (m *holdMetrics) Latency(backend, op string, d time.Duration) {}
+func (m *holdMetrics) Hold(backend string, d time.Duration) {
+	m.holds = append(m.holds, d)
+}
@@ -0,0 +1,194 @@
+package lid
+
+import (
+	"time"
+)
+
+// ------------------------------------------------------------
+// MIDDLEWARE
+
+// Middleware wraps a Service with additional behaviour, answering
+// the wrapped service.
+type Middleware func(Service) Service
+
+// Chain combines the middleware into a single middleware. The first
+// item is the outermost, so it sees each call first and each
+// response last. Optional interfaces on the wrapped service (i.e.
+// ServiceDebug and ServiceClockDebug) are preserved by every link in
+// the chain.
+func Chain(mw ...Middleware) Middleware {
+	return func(s Service) Service {
+		for i := len(mw) - 1; i >= 0; i-- {
+			if mw[i] != nil {
+				s = preserve(mw[i](s), s)
+			}
+		}
+		return s
+	}
+}
+
+// Unwrap answers the service wrapped by s, or nil if s is
+// not a wrapper.
+func Unwrap(s Service) Service {
+	if w, ok := s.(interface{ Unwrap() Service }); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// LOGGING
+
+// Logger is the minimal logging interface used by the logging
+// middleware. The standard library's *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogging answers a middleware that logs every call, the
+// result and the time it took.
+func WithLogging(l Logger) Middleware {
+	return func(next Service) Service {
+		return preserve(&loggingService{next: next, log: l}, next)
+	}
+}
+
+type loggingService struct {
+	next Service
+	log  Logger
+}
+
+func (s *loggingService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Lock(req, opts)
+	s.log.Printf("lid: lock sig=%v signee=%v level=%v status=%v prev=%v err=%v (%v)", req.Signature, req.Signee, req.Level, resp.Status, resp.PreviousSignee, err, time.Since(start))
+	return resp, err
+}
+
+func (s *loggingService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Unlock(req, opts)
+	s.log.Printf("lid: unlock sig=%v signee=%v status=%v err=%v (%v)", req.Signature, req.Signee, resp.Status, err, time.Since(start))
+	return resp, err
+}
+
+func (s *loggingService) Check(signature string) (CheckResponse, error) {
+	start := time.Now()
+	resp, err := s.next.Check(signature)
+	s.log.Printf("lid: check sig=%v signee=%v level=%v err=%v (%v)", signature, resp.Signee, resp.Level, err, time.Since(start))
+	return resp, err
+}
+
+func (s *loggingService) Unwrap() Service {
+	return s.next
+}
+
+// ------------------------------------------------------------
+// VALIDATION
+
+// WithValidation answers a middleware that rejects invalid requests
+// with ErrBadRequest before they reach the wrapped service.
+func WithValidation() Middleware {
+	return func(next Service) Service {
+		return preserve(&validationService{next: next}, next)
+	}
+}
+
+type validationService struct {
+	next Service
+}
+
+func (s *validationService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	if !req.IsValid() {
+		return LockResponse{}, ErrBadRequest
+	}
+	return s.next.Lock(req, opts)
+}
+
+func (s *validationService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	if !req.IsValid() {
+		return UnlockResponse{}, ErrBadRequest
+	}
+	return s.next.Unlock(req, opts)
+}
+
+func (s *validationService) Check(signature string) (CheckResponse, error) {
+	if signature == "" {
+		return CheckResponse{}, ErrBadRequest
+	}
+	return s.next.Check(signature)
+}
+
+func (s *validationService) Unwrap() Service {
+	return s.next
+}
+
+// ------------------------------------------------------------
+// PRESERVE
+
+// preserve answers wrapper, extended with any optional interfaces
+// implemented by inner that wrapper lacks. Each interface is taken
+// from wrapper if it has it, otherwise from inner.
+func preserve(wrapper, inner Service) Service {
+	extend := false
+	d, hasDebug := wrapper.(ServiceDebug)
+	if !hasDebug {
+		d, hasDebug = inner.(ServiceDebug)
+		extend = extend || hasDebug
+	}
+	c, hasClockDebug := wrapper.(ServiceClockDebug)
+	if !hasClockDebug {
+		c, hasClockDebug = inner.(ServiceClockDebug)
+		extend = extend || hasClockDebug
+	}
+	if !extend {
+		return wrapper
+	}
+	switch {
+	case hasDebug && hasClockDebug:
+		return &fullDebugService{&debugService{Service: wrapper, debug: d}, c}
+	case hasDebug:
+		return &debugService{Service: wrapper, debug: d}
+	case hasClockDebug:
+		return &clockDebugService{Service: wrapper, debug: c}
+	}
+	return wrapper
+}
+
+// debugService forwards ServiceDebug calls to a wrapped service.
+type debugService struct {
+	Service
+	debug ServiceDebug
+}
+
+func (s *debugService) SetDuration(d time.Duration) {
+	s.debug.SetDuration(d)
+}
+
+func (s *debugService) Unwrap() Service {
+	return Unwrap(s.Service)
+}
+
+// clockDebugService forwards ServiceClockDebug calls to a wrapped service.
+type clockDebugService struct {
+	Service
+	debug ServiceClockDebug
+}
+
+func (s *clockDebugService) SetClock(c Clock) {
+	s.debug.SetClock(c)
+}
+
+func (s *clockDebugService) Unwrap() Service {
+	return Unwrap(s.Service)
+}
+
+// fullDebugService forwards both ServiceDebug and ServiceClockDebug calls.
+type fullDebugService struct {
+	*debugService
+	clock ServiceClockDebug
+}
+
+func (s *fullDebugService) SetClock(c Clock) {
+	s.clock.SetClock(c)
+}
@@ -0,0 +1,73 @@
+package lid_test
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"testing"
+	"time"
+)
+
+// TestPreserve verifies each optional interface survives a middleware
+// that implements only the other, and that the middleware's own
+// implementation is the one called.
+func TestPreserve(t *testing.T) {
+	ms, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	inner := &debugRecorder{Service: ms}
+	outer := &durationRecorder{}
+	mw := func(next lid.Service) lid.Service {
+		outer.Service = next
+		return outer
+	}
+	s := lid.Chain(mw)(inner)
+
+	sd, ok := s.(lid.ServiceDebug)
+	if !ok {
+		t.Fatal("chain lost ServiceDebug")
+	}
+	sc, ok := s.(lid.ServiceClockDebug)
+	if !ok {
+		t.Fatal("chain lost ServiceClockDebug")
+	}
+	sd.SetDuration(time.Minute)
+	clock := lid.NewFakeClock(time.Now())
+	sc.SetClock(clock)
+	if outer.duration != time.Minute || inner.duration != 0 {
+		t.Fatal("SetDuration reached outer", outer.duration, "inner", inner.duration)
+	}
+	if inner.clock != clock {
+		t.Fatal("SetClock didn't reach the inner service")
+	}
+	if lid.Unwrap(s) != inner {
+		t.Fatal("Unwrap has", lid.Unwrap(s))
+	}
+}
+
+// debugRecorder records the ServiceDebug and ServiceClockDebug calls.
+type debugRecorder struct {
+	lid.Service
+	duration time.Duration
+	clock    lid.Clock
+}
+
+func (s *debugRecorder) SetDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *debugRecorder) SetClock(c lid.Clock) {
+	s.clock = c
+}
+
+// durationRecorder is a middleware that implements ServiceDebug only.
+type durationRecorder struct {
+	lid.Service
+	duration time.Duration
+}
+
+func (s *durationRecorder) SetDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *durationRecorder) Unwrap() lid.Service {
+	return s.Service
+}
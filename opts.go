@@ -1,6 +1,7 @@
 package lid
 
 import (
+	"context"
 	"time"
 )
 
@@ -9,16 +10,18 @@ import (
 
 // LockOpts provides options for the Lock operation.
 type LockOpts struct {
-	Force      bool          `json:"force,omitempty"` // If true then force the lock, even if someone else owns it.
-	Duration   time.Duration // Override the service default
-	TimeToLive time.Duration // Override the service default
+	Force      bool            `json:"force,omitempty"` // If true then force the lock, even if someone else owns it.
+	Duration   time.Duration   // Override the service default
+	TimeToLive time.Duration   // Override the service default
+	Context    context.Context `json:"-"` // Optional. Carries the trace span for this call (see ContextWithSpan).
 }
 
 // ------------------------------------------------------------
 // UNLOCK-OPTS
 
-// UnlockOpts is a placeholder in case we ever have options.
+// UnlockOpts provides options for the Unlock operation.
 type UnlockOpts struct {
+	Context context.Context `json:"-"` // Optional. Carries the trace span for this call (see ContextWithSpan).
 }
 
 // ------------------------------------------------------------
@@ -29,4 +32,21 @@ type ServiceOpts struct {
 	Table      string        // Name of the table with lock data. NOTE: The package will manage this table, deleting it at will.
 	Duration   time.Duration // The duration before the lock expires.
 	TimeToLive time.Duration // Non-empty values will enable time to live on the lock table and expire items after the duration.
+	Clock      Clock         // The source of the current time. Defaults to SystemClock.
+	// ClockSkewTolerance is the difference allowed between the clocks of the hosts
+	// sharing a lock table. A lock is not considered expired until it has been
+	// expired for this long.
+	ClockSkewTolerance time.Duration
+	// OnClockSkew, if set, enables skew detection on services that support it. It
+	// is called when a record or the backend's clock shows a clock skew beyond
+	// the ClockSkewTolerance, in either direction.
+	OnClockSkew ClockSkewFunc
+}
+
+// Now answers the current time from the Clock.
+func (o ServiceOpts) Now() time.Time {
+	if o.Clock != nil {
+		return o.Clock.Now()
+	}
+	return time.Now()
 }
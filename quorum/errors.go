@@ -0,0 +1,16 @@
+package lidquorum
+
+import (
+	"errors"
+	"github.com/hackborn/lid"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errMembersRequired  = errors.New("Bad request: Members required")
+	errNoQuorum         = lid.NewTransientError(errors.New("No quorum: too few members answered"))
+	errValidityExpired  = lid.NewTransientError(errors.New("No quorum: the lock expired while acquiring"))
+)
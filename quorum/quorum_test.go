@@ -0,0 +1,182 @@
+package lidquorum
+
+import (
+	"errors"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestFaults verifies locking with failing, conflicting and slow members.
+func TestFaults(t *testing.T) {
+	down := errors.New("down")
+	cases := []struct {
+		Faults     []fault
+		Held       []string // The signee already holding each member, if any
+		WantStatus lid.LockResponseStatus
+		WantErr    error
+		WantHeld   []bool // Members holding the lock afterwards
+	}{
+		{[]fault{{}, {}, {}}, nil, lid.LockOk, nil, []bool{true, true, true}},
+		{[]fault{{err: down}, {}, {}}, nil, lid.LockOk, nil, []bool{false, true, true}},
+		{[]fault{{err: down}, {err: down}, {}}, nil, lid.LockFailed, errNoQuorum, []bool{false, false, false}},
+		{[]fault{{}, {}, {}}, []string{"x", "", ""}, lid.LockOk, nil, []bool{false, true, true}},
+		{[]fault{{}, {}, {}}, []string{"x", "x", ""}, lid.LockFailed, lid.ErrForbidden, []bool{false, false, false}},
+		{[]fault{{err: down}, {}, {}}, []string{"", "x", ""}, lid.LockFailed, errNoQuorum, []bool{false, false, false}},
+		// A member I already held keeps my lock.
+		{[]fault{{}, {err: down}, {err: down}}, []string{"0", "", ""}, lid.LockFailed, errNoQuorum, []bool{true, false, false}},
+		// A member that locks but answers an error is still released.
+		{[]fault{{err: down, applied: true}, {err: down}, {}}, nil, lid.LockFailed, errNoQuorum, []bool{false, false, false}},
+		// Slow members use up the lock before the majority answers.
+		{[]fault{{delay: 6 * time.Second}, {delay: 6 * time.Second}, {}}, nil, lid.LockFailed, errValidityExpired, []bool{false, false, false}},
+		{[]fault{{delay: 6 * time.Second}, {}, {}}, nil, lid.LockOk, nil, []bool{true, true, true}},
+	}
+	for i, tc := range cases {
+		clock := lid.NewFakeClock(time.Unix(1000, 0))
+		var plain []lid.Service
+		var members []lid.Service
+		for j, f := range tc.Faults {
+			m, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+			lid.MustErr(err)
+			if j < len(tc.Held) && tc.Held[j] != "" {
+				_, err = m.Lock(lid.LockRequest{Signature: "a", Signee: tc.Held[j]}, nil)
+				lid.MustErr(err)
+			}
+			f.Service, f.clock = m, clock
+			plain = append(plain, m)
+			members = append(members, &f)
+		}
+		s, err := NewService(members, QuorumOpts{Duration: time.Second * 10, Clock: clock})
+		lid.MustErr(err)
+
+		resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+		if resp.Status != tc.WantStatus || err != tc.WantErr {
+			t.Fatal("case", i, "expected", tc.WantStatus, tc.WantErr, "but have", resp.Status, err)
+		}
+		for j, m := range plain {
+			check, _ := m.Check("a")
+			if held := check.Signee == "0"; held != tc.WantHeld[j] {
+				t.Fatal("case", i, "member", j, "expected held", tc.WantHeld[j], "but have", held)
+			}
+		}
+	}
+}
+
+// TestUnlockAndCheck verifies unlocking and checking need a majority.
+func TestUnlockAndCheck(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	var faults []*fault
+	var members []lid.Service
+	for i := 0; i < 3; i++ {
+		m, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+		lid.MustErr(err)
+		f := &fault{Service: m, clock: clock}
+		faults = append(faults, f)
+		members = append(members, f)
+	}
+	s, err := NewService(members, QuorumOpts{Duration: time.Second * 10, Clock: clock})
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0", Level: 1}, nil)
+	lid.MustErr(err)
+
+	faults[0].err = errors.New("down")
+	if check, err := s.Check("a"); err != nil || check.Signee != "0" || check.Level != 1 {
+		t.Fatal("expected the lock but have", check, err)
+	}
+	faults[1].err = errors.New("down")
+	if _, err = s.Check("a"); err != errNoQuorum {
+		t.Fatal("expected no quorum but have", err)
+	}
+	if _, err = s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil); err != errNoQuorum {
+		t.Fatal("expected no quorum but have", err)
+	}
+	faults[1].err = nil
+	resp, err := s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil)
+	if err != nil || resp.Status != lid.UnlockOk {
+		t.Fatal("expected the unlock but have", resp.Status, err)
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SERVICES
+
+// fault wraps a member, failing every call with err or
+// advancing the clock by delay before each call. If applied,
+// failing locks and unlocks reach the member first.
+type fault struct {
+	lid.Service
+	err     error
+	applied bool
+	delay   time.Duration
+	clock   *lid.FakeClock
+}
+
+func (f *fault) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if f.err != nil {
+		if f.applied {
+			f.Service.Lock(req, opts)
+		}
+		return lid.LockResponse{}, f.err
+	}
+	f.clock.Advance(f.delay)
+	return f.Service.Lock(req, opts)
+}
+
+func (f *fault) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if f.err != nil {
+		if f.applied {
+			f.Service.Unlock(req, opts)
+		}
+		return lid.UnlockResponse{}, f.err
+	}
+	return f.Service.Unlock(req, opts)
+}
+
+func (f *fault) Check(signature string) (lid.CheckResponse, error) {
+	if f.err != nil {
+		return lid.CheckResponse{}, f.err
+	}
+	return f.Service.Check(signature)
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type quorumServiceBootstrap struct {
+	size int
+}
+
+func (b *quorumServiceBootstrap) OpenService() lid.Service {
+	clock := lid.NewDebugClock()
+	var members []lid.Service
+	for i := 0; i < b.size; i++ {
+		m, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+		lid.MustErr(err)
+		members = append(members, m)
+	}
+	service, err := _newService(members, QuorumOpts{Duration: time.Second * 10, Clock: clock})
+	lid.MustErr(err)
+	return lid.NewDebugWrapper(service, clock)
+}
+
+func (b *quorumServiceBootstrap) CloseService() error {
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	services = append(services, &quorumServiceBootstrap{size: 1})
+	services = append(services, &quorumServiceBootstrap{size: 3})
+	return services
+}
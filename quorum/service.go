@@ -0,0 +1,258 @@
+package lidquorum
+
+import (
+	"github.com/hackborn/lid"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// QUORUM-OPTS
+
+// QuorumOpts provides options for the quorum service.
+type QuorumOpts struct {
+	// Duration is the lock duration of the member services. LockOpts.Duration
+	// overrides it, as it does for the members. Required.
+	Duration time.Duration
+	// Drift is the clock drift allowed between the members, taken from the
+	// validity window. Defaults to 1% of the duration plus 2ms.
+	Drift time.Duration
+	// Clock measures the time spent acquiring. Defaults to SystemClock.
+	Clock lid.Clock
+}
+
+// ------------------------------------------------------------
+// QUORUM-SERVICE
+
+// quorumService provides a lid.Service on N independent member services,
+// in the style of Redlock. Each call goes to every member at once.
+//
+// A lock is granted when a majority of members grant it, and the time
+// spent acquiring leaves some of the lock's duration (less the drift) to
+// use it. Otherwise the lock is released on every member, since a member
+// that failed may still have granted it.
+type quorumService struct {
+	members []lid.Service
+	opts    QuorumOpts
+}
+
+// NewService constructs a new quorum service on the members. Use an odd
+// number of members that fail independently.
+func NewService(members []lid.Service, opts QuorumOpts) (lid.Service, error) {
+	return _newService(members, opts)
+}
+
+func _newService(members []lid.Service, opts QuorumOpts) (*quorumService, error) {
+	if len(members) < 1 {
+		return nil, errMembersRequired
+	}
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	if opts.Clock == nil {
+		opts.Clock = lid.SystemClock
+	}
+	return &quorumService{members: members, opts: opts}, nil
+}
+
+func (s *quorumService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	start := s.opts.Clock.Now()
+	results := make([]lockResult, len(s.members))
+	s.fanOut(func(i int, m lid.Service) {
+		results[i].resp, results[i].err = m.Lock(req, opts)
+	})
+	elapsed := s.opts.Clock.Now().Sub(start)
+
+	var granted []int
+	var forbidden int
+	statuses := make(map[lid.LockResponseStatus]int)
+	for i, r := range results {
+		if r.err == nil && r.resp.Ok() {
+			granted = append(granted, i)
+			statuses[r.resp.Status]++
+		} else if isForbidden(r.err) {
+			forbidden++
+		}
+	}
+
+	if len(granted) >= s.majority() && elapsed < s.validity(opts) {
+		return s.lockResponse(results, granted, statuses), nil
+	}
+
+	// No quorum: release what I may have acquired so others aren't
+	// blocked, but not a lock I already held. A member that answered
+	// an error may have locked, so it's released too. Errors are
+	// ignored; the members I can't reach expire.
+	ureq := lid.UnlockRequest{Signature: req.Signature, Signee: req.Signee}
+	s.fanOut(func(i int, m lid.Service) {
+		if results[i].err == nil && results[i].resp.Status == lid.LockRenewed {
+			return
+		}
+		m.Unlock(ureq, unlockOpts(opts))
+	})
+	if forbidden >= s.majority() {
+		return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
+	}
+	if len(granted) >= s.majority() {
+		return lid.LockResponse{Status: lid.LockFailed}, errValidityExpired
+	}
+	return lid.LockResponse{Status: lid.LockFailed}, errNoQuorum
+}
+
+func (s *quorumService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	results := make([]unlockResult, len(s.members))
+	s.fanOut(func(i int, m lid.Service) {
+		results[i].resp, results[i].err = m.Unlock(req, opts)
+	})
+
+	var released, ok, forbidden int
+	for _, r := range results {
+		if r.err == nil && r.resp.Ok() {
+			released++
+			if r.resp.Status == lid.UnlockOk {
+				ok++
+			}
+		} else if isForbidden(r.err) {
+			forbidden++
+		}
+	}
+	switch {
+	case forbidden >= s.majority():
+		return lid.UnlockResponse{}, lid.ErrForbidden
+	case released >= s.majority() && ok > 0:
+		return lid.UnlockResponse{Status: lid.UnlockOk}, nil
+	case released >= s.majority():
+		return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
+	}
+	return lid.UnlockResponse{}, errNoQuorum
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *quorumService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	results := make([]checkResult, len(s.members))
+	s.fanOut(func(i int, m lid.Service) {
+		results[i].resp, results[i].err = m.Check(signature)
+	})
+
+	// Answer the state a majority agree on.
+	var notFound int
+	counts := make(map[lid.CheckResponse]int)
+	for _, r := range results {
+		if r.err == nil {
+			counts[r.resp]++
+			if counts[r.resp] >= s.majority() {
+				return r.resp, nil
+			}
+		} else if r.err == lid.ErrNotFound {
+			notFound++
+		}
+	}
+	if notFound >= s.majority() {
+		return lid.CheckResponse{}, lid.ErrNotFound
+	}
+	return lid.CheckResponse{}, errNoQuorum
+}
+
+// fanOut() runs fn on every member at once, answering when all are done.
+func (s *quorumService) fanOut(fn func(int, lid.Service)) {
+	var wg sync.WaitGroup
+	wg.Add(len(s.members))
+	for i, m := range s.members {
+		go func(i int, m lid.Service) {
+			defer wg.Done()
+			fn(i, m)
+		}(i, m)
+	}
+	wg.Wait()
+}
+
+// lockResponse() answers the status most of the granting members
+// reported, preferring a transfer so the previous owner is known.
+func (s *quorumService) lockResponse(results []lockResult, granted []int, statuses map[lid.LockResponseStatus]int) lid.LockResponse {
+	status := lid.LockFailed
+	for _, st := range []lid.LockResponseStatus{lid.LockTransferred, lid.LockOk, lid.LockRenewed} {
+		if statuses[st] > statuses[status] {
+			status = st
+		}
+	}
+	resp := lid.LockResponse{Status: status}
+	if status == lid.LockTransferred {
+		for _, i := range granted {
+			if results[i].resp.Status == lid.LockTransferred {
+				resp.PreviousSignee = results[i].resp.PreviousSignee
+				break
+			}
+		}
+	}
+	return resp
+}
+
+func (s *quorumService) majority() int {
+	return len(s.members)/2 + 1
+}
+
+// validity() answers the time acquiring can take before the lock
+// is too close to expiring to be useful.
+func (s *quorumService) validity(opts *lid.LockOpts) time.Duration {
+	d := s.opts.Duration
+	if opts != nil && opts.Duration != emptyDuration {
+		d = opts.Duration
+	}
+	drift := s.opts.Drift
+	if drift == emptyDuration {
+		drift = d/100 + 2*time.Millisecond
+	}
+	return d - drift
+}
+
+// ------------------------------------------------------------
+// RESULTS
+
+type lockResult struct {
+	resp lid.LockResponse
+	err  error
+}
+
+type unlockResult struct {
+	resp lid.UnlockResponse
+	err  error
+}
+
+type checkResult struct {
+	resp lid.CheckResponse
+	err  error
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func isForbidden(err error) bool {
+	e, ok := err.(*lid.Error)
+	return ok && e.Code == lid.Forbidden
+}
+
+func unlockOpts(opts *lid.LockOpts) *lid.UnlockOpts {
+	if opts != nil {
+		return &lid.UnlockOpts{Context: opts.Context}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	emptyDuration time.Duration
+)
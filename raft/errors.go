@@ -0,0 +1,16 @@
+package lidraft
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errBadResponse      = errors.New("Unexpected response from the state machine")
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errLocalIdRequired  = errors.New("Bad request: Config with a LocalID required")
+	errStoresRequired   = errors.New("Bad request: Stores and transport required")
+	errUnknownCommand   = errors.New("Unknown command")
+)
@@ -0,0 +1,263 @@
+package lidraft
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestReplication verifies every node reaches the same state,
+// and a new leader answers with the old leader's locks.
+func TestReplication(t *testing.T) {
+	c := newTestCluster(3)
+	defer c.close()
+
+	resp, err := c.Lock(lid.LockRequest{Signature: "a", Signee: "0", Level: 1}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("expected the lock but have", resp.Status, err)
+	}
+	c.failover()
+	if _, err = c.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the new leader to have the lock but have", err)
+	}
+	check, err := c.Check("a")
+	if err != nil || check.Signee != "0" || check.Level != 1 {
+		t.Fatal("expected the lock but have", check, err)
+	}
+
+	// Followers answer a transient error, so a client can find the leader.
+	for _, n := range c.nodes {
+		if n.raft.State() == raft.Follower {
+			if _, err = n.Check("a"); !lid.IsTransient(err) {
+				t.Fatal("expected a transient error from a follower but have", err)
+			}
+		}
+	}
+}
+
+// TestSnapshot verifies a node restores the locks from a snapshot.
+func TestSnapshot(t *testing.T) {
+	c := newTestCluster(3)
+	defer c.close()
+
+	_, err := c.Lock(lid.LockRequest{Signature: "a", Signee: "0", Level: 1}, nil)
+	lid.MustErr(err)
+	leader := c.leader()
+	lid.MustErr(leader.raft.Snapshot().Error())
+
+	f := newFsm()
+	meta, err := c.snapshots[leader.id].List()
+	lid.MustErr(err)
+	_, rc, err := c.snapshots[leader.id].Open(meta[0].ID)
+	lid.MustErr(err)
+	lid.MustErr(f.Restore(rc))
+	if check, err := f.machine.Check("a"); err != nil || check.Signee != "0" {
+		t.Fatal("expected the lock in the snapshot but have", check, err)
+	}
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *raftService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *raftService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// ------------------------------------------------------------
+// TEST-CLUSTER
+
+// testCluster is a lid.Service on a cluster of nodes in one process,
+// sending every call to the current leader.
+type testCluster struct {
+	nodes     []*testNode
+	snapshots map[string]*raft.InmemSnapshotStore
+
+	// failAt, if positive, fails over the leader before that call.
+	mutex  sync.Mutex
+	calls  int
+	failAt int
+}
+
+type testNode struct {
+	*raftService
+	id     string
+	closed bool
+}
+
+func newTestCluster(size int) *testCluster {
+	c := &testCluster{snapshots: make(map[string]*raft.InmemSnapshotStore)}
+	var servers []raft.Server
+	var transports []*raft.InmemTransport
+	for i := 0; i < size; i++ {
+		addr, transport := raft.NewInmemTransportWithTimeout("", 50*time.Millisecond)
+		id := "node" + strconv.Itoa(i)
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: addr})
+		transports = append(transports, transport)
+	}
+	for i, transport := range transports {
+		for j, other := range transports {
+			if i != j {
+				transport.Connect(other.LocalAddr(), other)
+			}
+		}
+	}
+	for i, transport := range transports {
+		id := string(servers[i].ID)
+		cfg := raft.DefaultConfig()
+		cfg.LocalID = servers[i].ID
+		cfg.HeartbeatTimeout = 50 * time.Millisecond
+		cfg.ElectionTimeout = 50 * time.Millisecond
+		cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+		cfg.CommitTimeout = 5 * time.Millisecond
+		cfg.Logger = hclog.NewNullLogger()
+		store := raft.NewInmemStore()
+		c.snapshots[id] = raft.NewInmemSnapshotStore()
+		ropts := RaftOpts{Config: cfg, Logs: store, Stable: store, Snapshots: c.snapshots[id], Transport: transport}
+		if i == 0 {
+			ropts.Bootstrap = servers
+		}
+		s, err := _newService(lid.ServiceOpts{Duration: time.Second * 10}, ropts)
+		lid.MustErr(err)
+		c.nodes = append(c.nodes, &testNode{raftService: s, id: id})
+	}
+	c.leader()
+	return c
+}
+
+func (c *testCluster) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	var resp lid.LockResponse
+	err := c.call(func(s lid.Service) error {
+		var err error
+		resp, err = s.Lock(req, opts)
+		return err
+	})
+	return resp, err
+}
+
+func (c *testCluster) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	var resp lid.UnlockResponse
+	err := c.call(func(s lid.Service) error {
+		var err error
+		resp, err = s.Unlock(req, opts)
+		return err
+	})
+	return resp, err
+}
+
+func (c *testCluster) Check(signature string) (lid.CheckResponse, error) {
+	var resp lid.CheckResponse
+	err := c.call(func(s lid.Service) error {
+		var err error
+		resp, err = s.Check(signature)
+		return err
+	})
+	return resp, err
+}
+
+func (c *testCluster) SetDuration(d time.Duration) {
+	for _, n := range c.nodes {
+		n.SetDuration(d)
+	}
+}
+
+func (c *testCluster) SetClock(clock lid.Clock) {
+	for _, n := range c.nodes {
+		n.SetClock(clock)
+	}
+}
+
+// call() sends fn to the leader, retrying on transient errors
+// while leadership changes.
+func (c *testCluster) call(fn func(lid.Service) error) error {
+	c.mutex.Lock()
+	c.calls++
+	if c.calls == c.failAt {
+		c.failover()
+	}
+	c.mutex.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := fn(c.leader())
+		if !lid.IsTransient(err) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// leader() answers the current leader, waiting for an election if needed.
+func (c *testCluster) leader() *testNode {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, n := range c.nodes {
+			if !n.closed && n.raft.State() == raft.Leader {
+				return n
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	panic("no leader elected")
+}
+
+// failover() shuts down the leader, waiting for a new one.
+func (c *testCluster) failover() {
+	old := c.leader()
+	old.closed = true
+	lid.MustErr(old.Close())
+	c.leader()
+}
+
+func (c *testCluster) close() {
+	for _, n := range c.nodes {
+		if !n.closed {
+			n.closed = true
+			n.Close()
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type raftServiceBootstrap struct {
+	failAt  int
+	cluster *testCluster
+}
+
+func (b *raftServiceBootstrap) OpenService() lid.Service {
+	b.cluster = newTestCluster(3)
+	b.cluster.failAt = b.failAt
+	return b.cluster
+}
+
+func (b *raftServiceBootstrap) CloseService() error {
+	b.cluster.close()
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	services = append(services, &raftServiceBootstrap{})
+	// Lose the leader in the middle of every script.
+	services = append(services, &raftServiceBootstrap{failAt: 2})
+	return services
+}
@@ -0,0 +1,274 @@
+package lidraft
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"github.com/hashicorp/raft"
+	"io"
+	"time"
+)
+
+// ------------------------------------------------------------
+// SERVICE
+
+// Service is a lid.Service on one node of a Raft cluster. Close it to
+// leave the cluster. Raft answers the underlying node, i.e. to add and
+// remove cluster members.
+type Service interface {
+	lid.Service
+	io.Closer
+	Raft() *raft.Raft
+}
+
+// RaftOpts provides the Raft configuration for a node.
+type RaftOpts struct {
+	Config    *raft.Config // Optional. The LocalID is required; other fields default to raft.DefaultConfig.
+	Logs      raft.LogStore
+	Stable    raft.StableStore
+	Snapshots raft.SnapshotStore
+	Transport raft.Transport
+	// Bootstrap, if set, bootstraps a new cluster with these servers. It is
+	// ignored if the stores already hold cluster state.
+	Bootstrap []raft.Server
+	// ApplyTimeout is how long to wait for a command to commit. Defaults to 10 seconds.
+	ApplyTimeout time.Duration
+}
+
+// ------------------------------------------------------------
+// RAFT-SERVICE
+
+// raftService provides a lid.Service implementation that replicates the
+// lidmem state machine across a Raft cluster. Every call, including
+// Check, is a command through the leader's log, so reads are
+// linearizable. The leader stamps each lock with its own clock, so
+// every replica makes the same decision.
+//
+// A node that isn't the leader answers a transient error; see
+// lid.WithRetry, and route clients to the leader.
+type raftService struct {
+	opts         lid.ServiceOpts
+	raft         *raft.Raft
+	applyTimeout time.Duration
+}
+
+// NewService constructs a new node of a Raft cluster.
+func NewService(opts lid.ServiceOpts, ropts RaftOpts) (Service, error) {
+	return _newService(opts, ropts)
+}
+
+func _newService(opts lid.ServiceOpts, ropts RaftOpts) (*raftService, error) {
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	if ropts.Config == nil || ropts.Config.LocalID == "" {
+		return nil, errLocalIdRequired
+	}
+	if ropts.Logs == nil || ropts.Stable == nil || ropts.Snapshots == nil || ropts.Transport == nil {
+		return nil, errStoresRequired
+	}
+	if ropts.ApplyTimeout == emptyDuration {
+		ropts.ApplyTimeout = defaultApplyTimeout
+	}
+	if len(ropts.Bootstrap) > 0 {
+		cfg := raft.Configuration{Servers: ropts.Bootstrap}
+		err := raft.BootstrapCluster(ropts.Config, ropts.Logs, ropts.Stable, ropts.Snapshots, ropts.Transport, cfg)
+		if err != nil && err != raft.ErrCantBootstrap {
+			return nil, err
+		}
+	}
+	r, err := raft.NewRaft(ropts.Config, newFsm(), ropts.Logs, ropts.Stable, ropts.Snapshots, ropts.Transport)
+	if err != nil {
+		return nil, err
+	}
+	return &raftService{opts: opts, raft: r, applyTimeout: ropts.ApplyTimeout}, nil
+}
+
+func (s *raftService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	now := s.opts.Now()
+	c := command{Op: lockCmd, Lock: req, Now: now, EndTime: now.Add(s.getDuration(opts))}
+	res, err := s.apply(c)
+	if err != nil {
+		return lid.LockResponse{}, err
+	}
+	return res.Lock, res.Err
+}
+
+func (s *raftService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	res, err := s.apply(command{Op: unlockCmd, Unlock: req})
+	if err != nil {
+		return lid.UnlockResponse{}, err
+	}
+	return res.Unlock, res.Err
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *raftService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	res, err := s.apply(command{Op: checkCmd, Signature: signature})
+	if err != nil {
+		return lid.CheckResponse{}, err
+	}
+	return res.Check, res.Err
+}
+
+// Close() leaves the cluster.
+func (s *raftService) Close() error {
+	return s.raft.Shutdown().Error()
+}
+
+func (s *raftService) Raft() *raft.Raft {
+	return s.raft
+}
+
+// apply() commits the command to the cluster, answering its result.
+func (s *raftService) apply(c command) (result, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return result{}, err
+	}
+	f := s.raft.Apply(b, s.applyTimeout)
+	err = f.Error()
+	if err != nil {
+		return result{}, raftErr(err)
+	}
+	res, ok := f.Response().(result)
+	if !ok {
+		return result{}, errBadResponse
+	}
+	return res, nil
+}
+
+func (s *raftService) getDuration(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.Duration != emptyDuration {
+		return opts.Duration
+	}
+	return s.opts.Duration
+}
+
+// ------------------------------------------------------------
+// FSM
+
+// fsm applies commands to a lidmem state machine.
+type fsm struct {
+	machine *lidmem.Machine
+}
+
+func newFsm() *fsm {
+	return &fsm{machine: lidmem.NewMachine()}
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	c := command{}
+	err := json.Unmarshal(l.Data, &c)
+	if err != nil {
+		return result{Err: err}
+	}
+	res := result{}
+	switch c.Op {
+	case lockCmd:
+		res.Lock, res.Err = f.machine.Lock(c.Lock, c.Now, c.EndTime)
+	case unlockCmd:
+		res.Unlock, res.Err = f.machine.Unlock(c.Unlock)
+	case checkCmd:
+		res.Check, res.Err = f.machine.Check(c.Signature)
+	default:
+		res.Err = errUnknownCommand
+	}
+	return res
+}
+
+// Snapshot() copies the records; raft doesn't call Apply
+// while this runs, but may once it returns.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{records: f.machine.Records()}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var records []lidmem.MachineRecord
+	err := json.NewDecoder(rc).Decode(&records)
+	if err != nil {
+		return err
+	}
+	f.machine.Restore(records)
+	return nil
+}
+
+type fsmSnapshot struct {
+	records []lidmem.MachineRecord
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s.records)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {
+}
+
+// ------------------------------------------------------------
+// COMMAND
+
+// command is a single entry in the log.
+type command struct {
+	Op        string            `json:"op"`
+	Lock      lid.LockRequest   `json:"lock,omitempty"`
+	Unlock    lid.UnlockRequest `json:"unlock,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+	Now       time.Time         `json:"now,omitempty"`      // The leader's time of the lock.
+	EndTime   time.Time         `json:"end_time,omitempty"` // The end of the lock, if acquired.
+}
+
+// result is the answer from applying a command. It never leaves
+// the node, so the errors are the originals.
+type result struct {
+	Lock   lid.LockResponse
+	Unlock lid.UnlockResponse
+	Check  lid.CheckResponse
+	Err    error
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// raftErr() wraps errors that may succeed if retried, which is any
+// that leadership may resolve.
+func raftErr(err error) error {
+	if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) ||
+		errors.Is(err, raft.ErrLeadershipTransferInProgress) || errors.Is(err, raft.ErrEnqueueTimeout) {
+		return lid.NewTransientError(err)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	checkCmd  = "check"
+	lockCmd   = "lock"
+	unlockCmd = "unlock"
+
+	defaultApplyTimeout = time.Second * 10
+)
+
+var (
+	emptyDuration time.Duration
+)
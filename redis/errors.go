@@ -0,0 +1,14 @@
+package lidredis
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errClientRequired     = errors.New("Client is required")
+	errDurationRequired   = errors.New("Bad request: Duration required")
+	errUnexpectedResponse = errors.New("Unexpected response from Redis")
+)
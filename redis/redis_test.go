@@ -0,0 +1,92 @@
+package lidredis
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hackborn/lid"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestTimeToLive verifies the time to live is applied as key expiry.
+func TestTimeToLive(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	opts := lid.ServiceOpts{Duration: time.Second * 10, TimeToLive: time.Minute}
+	s, err := NewService(opts, client)
+	lid.MustErr(err)
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if ttl := mr.TTL("lid:a"); ttl != time.Minute {
+		t.Fatal("expected a minute ttl but have", ttl)
+	}
+	mr.FastForward(2 * time.Minute)
+	if _, err = s.Check("a"); err != lid.ErrNotFound {
+		t.Fatal("expected the lock to be gone but have", err)
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s, err := lid.Open("redis://" + mr.Addr() + "/0?duration=10s&table=locks")
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if !mr.Exists("locks:a") {
+		t.Fatal("expected the lock in the table")
+	}
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *redisService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *redisService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type redisServiceBootstrap struct {
+	t      *testing.T
+	server *miniredis.Miniredis
+	client *redis.Client
+}
+
+func (b *redisServiceBootstrap) OpenService() lid.Service {
+	b.server = miniredis.RunT(b.t)
+	b.client = redis.NewClient(&redis.Options{Addr: b.server.Addr()})
+	opts := lid.ServiceOpts{Duration: time.Second * 10}
+	service, err := _newService(opts, b.client)
+	lid.MustErr(err)
+	return service
+}
+
+func (b *redisServiceBootstrap) CloseService() error {
+	err := b.client.Close()
+	b.server.Close()
+	return err
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &redisServiceBootstrap{t: t}
+	services = append(services, bootstrap)
+	return services
+}
@@ -0,0 +1,272 @@
+package lidredis
+
+import (
+	"context"
+	"github.com/hackborn/lid"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------
+// REDIS-SERVICE
+
+// redisService provides a lid.Service implementation on Redis.
+// Each lock is a hash; the lock and unlock decisions are made
+// atomically in Lua scripts.
+type redisService struct {
+	client redis.UniversalClient
+	opts   lid.ServiceOpts
+	prefix string
+}
+
+// init() registers the "redis" backend, i.e.
+// redis://localhost:6379/0?duration=30s&table=locks
+func init() {
+	lid.Register("redis", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		// lid.Open removed its own options, which Redis would reject.
+		ropts, err := redis.ParseURL(u.String())
+		if err != nil {
+			return nil, err
+		}
+		return NewService(opts, redis.NewClient(ropts))
+	})
+}
+
+// NewService constructs a new service on the Redis client. Locks are
+// stored under keys prefixed with the Table option, or "lid" if empty.
+func NewService(opts lid.ServiceOpts, client redis.UniversalClient) (lid.Service, error) {
+	return _newService(opts, client)
+}
+
+func _newService(opts lid.ServiceOpts, client redis.UniversalClient) (*redisService, error) {
+	if client == nil {
+		return nil, errClientRequired
+	}
+	if opts.Duration == emptyDuration {
+		return nil, errDurationRequired
+	}
+	prefix := opts.Table
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	return &redisService{client: client, opts: opts, prefix: prefix + ":"}, nil
+}
+
+func (s *redisService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	now := s.opts.Now()
+	duration := s.opts.Duration
+	if opts != nil && opts.Duration != emptyDuration {
+		duration = opts.Duration
+	}
+	// Expiry is compared in Lua, where numbers are doubles, so
+	// microseconds keep full precision.
+	expired := now.Add(-s.opts.ClockSkewTolerance).UnixNano() / int64(time.Microsecond)
+	expires := now.Add(duration).UnixNano() / int64(time.Microsecond)
+	ttl := s.getTtl(opts) / time.Millisecond
+
+	ctx := lockContext(opts)
+	span := s.startSpan(ctx, "EVALSHA acquire")
+	defer span.End()
+	keys := []string{s.key(req.Signature)}
+	r, err := acquireScript.Run(redisContext(ctx), s.client, keys, req.Signee, req.Level, expired, expires, int64(ttl)).StringSlice()
+	if err != nil {
+		span.SetError(err)
+		return lid.LockResponse{}, transientErr(err)
+	}
+	if len(r) != 2 {
+		return lid.LockResponse{}, errUnexpectedResponse
+	}
+	switch r[0] {
+	case okStatus:
+		return lid.LockResponse{Status: lid.LockOk}, nil
+	case renewedStatus:
+		return lid.LockResponse{Status: lid.LockRenewed}, nil
+	case transferredStatus:
+		return lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: r[1]}, nil
+	case forbiddenStatus:
+		return lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden
+	}
+	return lid.LockResponse{}, errUnexpectedResponse
+}
+
+func (s *redisService) getTtl(opts *lid.LockOpts) time.Duration {
+	if opts != nil && opts.TimeToLive != emptyDuration {
+		return opts.TimeToLive
+	}
+	return s.opts.TimeToLive
+}
+
+func (s *redisService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+
+	ctx := unlockContext(opts)
+	span := s.startSpan(ctx, "EVALSHA release")
+	defer span.End()
+	keys := []string{s.key(req.Signature)}
+	r, err := releaseScript.Run(redisContext(ctx), s.client, keys, req.Signee).Text()
+	if err != nil {
+		span.SetError(err)
+		return lid.UnlockResponse{}, transientErr(err)
+	}
+	switch r {
+	case okStatus:
+		return lid.UnlockResponse{Status: lid.UnlockOk}, nil
+	case noLockStatus:
+		return lid.UnlockResponse{Status: lid.UnlockNoLock}, nil
+	case forbiddenStatus:
+		return lid.UnlockResponse{}, lid.ErrForbidden
+	}
+	return lid.UnlockResponse{}, errUnexpectedResponse
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *redisService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	r, err := s.client.HMGet(context.Background(), s.key(signature), signeeField, levelField).Result()
+	if err != nil {
+		return lid.CheckResponse{}, transientErr(err)
+	}
+	signee, _ := r[0].(string)
+	if signee == "" {
+		return lid.CheckResponse{}, lid.ErrNotFound
+	}
+	level, _ := r[1].(string)
+	l, err := strconv.Atoi(level)
+	if err != nil {
+		return lid.CheckResponse{}, err
+	}
+	return lid.CheckResponse{Signee: signee, Level: l}, nil
+}
+
+func (s *redisService) key(signature string) string {
+	return s.prefix + signature
+}
+
+// startSpan() answers a child span of ctx for a Redis command.
+func (s *redisService) startSpan(ctx context.Context, command string) lid.Span {
+	span := lid.StartSpan(ctx, "redis."+command)
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", command)
+	return span
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func lockContext(opts *lid.LockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+func unlockContext(opts *lid.UnlockOpts) context.Context {
+	if opts != nil {
+		return opts.Context
+	}
+	return nil
+}
+
+// redisContext() answers ctx, or the background context if ctx is nil.
+func redisContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// transientErr() wraps errors that may succeed if retried: network
+// failures and the errors Redis uses while it's loading or failing over.
+func transientErr(err error) error {
+	if err == nil || err == redis.Nil {
+		return err
+	}
+	if _, ok := err.(net.Error); ok {
+		return lid.NewTransientError(err)
+	}
+	msg := err.Error()
+	for _, prefix := range transientPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return lid.NewTransientError(err)
+		}
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultPrefix = "lid"
+
+	signeeField  = "signee"
+	levelField   = "level"
+	expiresField = "expires"
+
+	okStatus          = "ok"
+	renewedStatus     = "renewed"
+	transferredStatus = "transferred"
+	forbiddenStatus   = "forbidden"
+	noLockStatus      = "nolock"
+)
+
+var (
+	emptyDuration time.Duration
+
+	transientPrefixes = []string{"LOADING", "BUSY", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "READONLY"}
+
+	// acquireScript acquires the lock. See Service.Lock() for the rules.
+	// KEYS: lock key
+	// ARGV: signee, level, expired (µs), expires (µs), ttl (ms, 0 for none)
+	acquireScript = redis.NewScript(`
+local cur = redis.call('HMGET', KEYS[1], '` + signeeField + `', '` + levelField + `', '` + expiresField + `')
+local status = '` + okStatus + `'
+local prev = ''
+if cur[1] then
+	if cur[1] == ARGV[1] then
+		status = '` + renewedStatus + `'
+	elseif tonumber(cur[2]) < tonumber(ARGV[2]) or tonumber(cur[3]) < tonumber(ARGV[3]) then
+		status = '` + transferredStatus + `'
+		prev = cur[1]
+	else
+		return {'` + forbiddenStatus + `', ''}
+	end
+end
+redis.call('HSET', KEYS[1], '` + signeeField + `', ARGV[1], '` + levelField + `', ARGV[2], '` + expiresField + `', ARGV[4])
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return {status, prev}
+`)
+
+	// releaseScript releases the lock. See Service.Unlock() for the rules.
+	// KEYS: lock key
+	// ARGV: signee
+	releaseScript = redis.NewScript(`
+local signee = redis.call('HGET', KEYS[1], '` + signeeField + `')
+if not signee then
+	return '` + noLockStatus + `'
+end
+if signee ~= ARGV[1] then
+	return '` + forbiddenStatus + `'
+end
+redis.call('DEL', KEYS[1])
+return '` + okStatus + `'
+`)
+)
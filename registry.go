@@ -0,0 +1,126 @@
+package lid
+
+import (
+	"errors"
+	"github.com/micro-go/lock"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// REGISTRY
+
+// Factory constructs a Service from a URL. The opts have already
+// been populated from the standard query parameters, which are removed
+// from the URL; the factory is free to read any others.
+type Factory func(u *url.URL, opts ServiceOpts) (Service, error)
+
+// Register makes a backend available to Open under the name, which
+// is the scheme of the URL. Backends register themselves when their
+// package is imported. Like database/sql, registering a nil factory
+// or the same name twice panics.
+func Register(name string, f Factory) {
+	defer lock.Write(&registryMutex).Unlock()
+	if f == nil {
+		panic("lid: Register factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("lid: Register called twice for " + name)
+	}
+	registry[name] = f
+}
+
+// Drivers answers the sorted names of the registered backends.
+func Drivers() []string {
+	defer lock.Read(&registryMutex).Unlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open constructs a Service from a URL, i.e.
+// "dynamodb://table?region=us-west-2&duration=30s" or "mem://?duration=10s".
+// The scheme selects the backend, which must have been registered by
+// importing its package. See ParseServiceOpts for the standard parameters.
+func Open(rawurl string) (Service, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := factory(u.Scheme)
+	if !ok {
+		return nil, errors.New("Unknown backend (" + u.Scheme + "), is the package imported?")
+	}
+	opts, err := ParseServiceOpts(u)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	for _, k := range serviceParams {
+		q.Del(k)
+	}
+	u.RawQuery = q.Encode()
+	return f(u, opts)
+}
+
+func factory(name string) (Factory, bool) {
+	defer lock.Read(&registryMutex).Unlock()
+	f, ok := registry[name]
+	return f, ok
+}
+
+// ParseServiceOpts answers the ServiceOpts described by the URL's
+// query parameters:
+// * table: ServiceOpts.Table
+// * duration: ServiceOpts.Duration, i.e. "30s"
+// * ttl: ServiceOpts.TimeToLive, i.e. "24h"
+// * skew: ServiceOpts.ClockSkewTolerance, i.e. "500ms"
+// Other parameters are ignored, and left for the backend.
+func ParseServiceOpts(u *url.URL) (ServiceOpts, error) {
+	opts := ServiceOpts{}
+	q := u.Query()
+	opts.Table = q.Get(tableParam)
+	var err error
+	opts.Duration, err = ParseDurationParam(q, durationParam, err)
+	opts.TimeToLive, err = ParseDurationParam(q, ttlParam, err)
+	opts.ClockSkewTolerance, err = ParseDurationParam(q, skewParam, err)
+	return opts, err
+}
+
+// ParseDurationParam() answers the duration in the named URL parameter,
+// or zero if it's absent. An error passed in is answered unchanged, so
+// backends can parse several parameters and check the error once.
+func ParseDurationParam(q url.Values, name string, err error) (time.Duration, error) {
+	v := q.Get(name)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New("Bad request: Invalid " + name + " (" + v + ")")
+	}
+	return d, nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	durationParam = "duration"
+	skewParam     = "skew"
+	tableParam    = "table"
+	ttlParam      = "ttl"
+)
+
+var (
+	// The standard query parameters, read by ParseServiceOpts.
+	serviceParams = []string{durationParam, skewParam, tableParam, ttlParam}
+
+	registryMutex sync.RWMutex
+	registry      = make(map[string]Factory)
+)
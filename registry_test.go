@@ -0,0 +1,67 @@
+package lid_test
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseServiceOpts verifies reading the standard query parameters.
+func TestParseServiceOpts(t *testing.T) {
+	cases := []struct {
+		URL     string
+		Want    lid.ServiceOpts
+		WantErr bool
+	}{
+		{"mem://", lid.ServiceOpts{}, false},
+		{"mem://?duration=10s&ttl=1h&skew=500ms&table=locks", lid.ServiceOpts{Table: "locks", Duration: 10 * time.Second, TimeToLive: time.Hour, ClockSkewTolerance: 500 * time.Millisecond}, false},
+		{"dynamodb://table?region=us-west-2&duration=30s", lid.ServiceOpts{Duration: 30 * time.Second}, false},
+		{"mem://?duration=10", lid.ServiceOpts{}, true},
+	}
+	for i, tc := range cases {
+		u, err := url.Parse(tc.URL)
+		lid.MustErr(err)
+		have, err := lid.ParseServiceOpts(u)
+		if (err != nil) != tc.WantErr || (err == nil && !reflect.DeepEqual(have, tc.Want)) {
+			t.Fatal("case", i, "have", have, err, "want", tc.Want, tc.WantErr)
+		}
+	}
+}
+
+// TestOpen verifies selecting a registered backend, which receives the
+// standard parameters as its opts and the URL for the rest.
+func TestOpen(t *testing.T) {
+	var haveOpts lid.ServiceOpts
+	var haveURL *url.URL
+	lid.Register("recordopts", func(u *url.URL, opts lid.ServiceOpts) (lid.Service, error) {
+		haveOpts, haveURL = opts, u
+		return lidmem.NewService(opts)
+	})
+	s, err := lid.Open("recordopts://host?duration=10s&table=locks&ttl=1h&region=here")
+	lid.MustErr(err)
+	want := lid.ServiceOpts{Table: "locks", Duration: 10 * time.Second, TimeToLive: time.Hour}
+	if s == nil || !reflect.DeepEqual(haveOpts, want) {
+		t.Fatal("have", haveOpts, "want", want)
+	}
+	if haveURL.Host != "host" || haveURL.RawQuery != "region=here" {
+		t.Fatal("backend has URL", haveURL)
+	}
+
+	cases := []struct {
+		URL     string
+		WantErr string
+	}{
+		{"recordopts://?duration=10", "Bad request: Invalid duration (10)"},
+		{"nope://", "Unknown backend (nope), is the package imported?"},
+	}
+	for i, tc := range cases {
+		haveOpts = lid.ServiceOpts{}
+		s, err := lid.Open(tc.URL)
+		if s != nil || err == nil || err.Error() != tc.WantErr || !reflect.DeepEqual(haveOpts, lid.ServiceOpts{}) {
+			t.Fatal("case", i, "have", s, err, "want", tc.WantErr)
+		}
+	}
+}
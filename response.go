@@ -1,5 +1,9 @@
 package lid
 
+import (
+	"strconv"
+)
+
 // ------------------------------------------------------------
 // LOCK-RESPONSE
 
@@ -66,3 +70,29 @@ const (
 	UnlockOk                                 // The lock was unlocked, no one owns it
 	UnlockNoLock                             // Technically I succeeded - there was nothing to unlock.
 )
+
+func (s LockResponseStatus) String() string {
+	switch s {
+	case LockFailed:
+		return "LockFailed"
+	case LockOk:
+		return "LockOk"
+	case LockTransferred:
+		return "LockTransferred"
+	case LockRenewed:
+		return "LockRenewed"
+	}
+	return "LockResponseStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+func (s UnlockResponseStatus) String() string {
+	switch s {
+	case UnlockFailed:
+		return "UnlockFailed"
+	case UnlockOk:
+		return "UnlockOk"
+	case UnlockNoLock:
+		return "UnlockNoLock"
+	}
+	return "UnlockResponseStatus(" + strconv.Itoa(int(s)) + ")"
+}
@@ -0,0 +1,167 @@
+package lid
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ------------------------------------------------------------
+// RETRY-OPTS
+
+// RetryOpts provides options for the retry middleware.
+type RetryOpts struct {
+	MaxAttempts int              // Total attempts per call, including the first. Defaults to 3.
+	Backoff     time.Duration    // Delay before the first retry, doubling after each. Defaults to 50ms.
+	MaxBackoff  time.Duration    // Upper limit on a single delay. Defaults to 2s.
+	Budget      time.Duration    // Upper limit on the time spent on a call, including delays. Zero for no limit.
+	IsTransient func(error) bool // Classifies the errors to retry. Defaults to IsTransient.
+}
+
+// ------------------------------------------------------------
+// RETRY-MIDDLEWARE
+
+// WithRetry answers a middleware that retries calls failing with a
+// transient error. Nothing else is retried; in particular a LockFailed
+// is a real answer and is returned immediately.
+//
+// Lock and Unlock aren't idempotent, and a transient error can hide an
+// attempt that actually succeeded. So after a transient failure, and only
+// then, I check who owns the lock before retrying, which needs a Check
+// that reads consistently. A lock that's mine is locked again, which is
+// harmless, but a renewal then can't be told from the lost attempt having
+// acquired it, so it's answered as LockOk; a caller never sees LockRenewed
+// for a lock it didn't hold. An unlock whose lock is gone is answered as
+// UnlockOk without sending it again. If the check fails transiently, I
+// wait and check again.
+func WithRetry(opts RetryOpts) Middleware {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 50 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 2 * time.Second
+	}
+	if opts.IsTransient == nil {
+		opts.IsTransient = IsTransient
+	}
+	return func(next Service) Service {
+		return preserve(&retryService{next: next, opts: opts}, next)
+	}
+}
+
+type retryService struct {
+	next Service
+	opts RetryOpts
+}
+
+func (s *retryService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	r := s.newRetrier()
+	resp, err := s.next.Lock(req, opts)
+	for s.opts.IsTransient(err) && r.wait() {
+		cur, cerr := s.state(req.Signature)
+		if cerr != nil {
+			// I can't tell what happened, so I can't safely lock again.
+			if s.opts.IsTransient(cerr) {
+				continue
+			}
+			return resp, err
+		}
+		resp, err = s.next.Lock(req, opts)
+		mine := cur.held && cur.Signee == req.Signee && cur.Level == req.Level
+		if mine && err == nil && resp.Status == LockRenewed {
+			resp = LockResponse{Status: LockOk}
+		}
+	}
+	return resp, err
+}
+
+func (s *retryService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	r := s.newRetrier()
+	resp, err := s.next.Unlock(req, opts)
+	for s.opts.IsTransient(err) && r.wait() {
+		cur, cerr := s.state(req.Signature)
+		if cerr != nil {
+			if s.opts.IsTransient(cerr) {
+				continue
+			}
+			return resp, err
+		}
+		if !cur.held {
+			return UnlockResponse{Status: UnlockOk}, nil
+		}
+		resp, err = s.next.Unlock(req, opts)
+	}
+	return resp, err
+}
+
+func (s *retryService) Check(signature string) (CheckResponse, error) {
+	r := s.newRetrier()
+	resp, err := s.next.Check(signature)
+	for s.opts.IsTransient(err) && r.wait() {
+		resp, err = s.next.Check(signature)
+	}
+	return resp, err
+}
+
+func (s *retryService) Unwrap() Service {
+	return s.next
+}
+
+// state() answers the current state of the lock.
+func (s *retryService) state(signature string) (lockState, error) {
+	resp, err := s.next.Check(signature)
+	if err == ErrNotFound {
+		return lockState{}, nil
+	} else if err != nil {
+		return lockState{}, err
+	}
+	return lockState{held: true, CheckResponse: resp}, nil
+}
+
+func (s *retryService) newRetrier() *retrier {
+	r := &retrier{opts: &s.opts, attempts: 1, delay: s.opts.Backoff}
+	if s.opts.Budget > 0 {
+		r.deadline = time.Now().Add(s.opts.Budget)
+	}
+	return r
+}
+
+// lockState is a lock as seen by Check.
+type lockState struct {
+	held bool
+	CheckResponse
+}
+
+// ------------------------------------------------------------
+// RETRIER
+
+// retrier tracks the attempts and delays of a single call.
+type retrier struct {
+	opts     *RetryOpts
+	attempts int
+	delay    time.Duration
+	deadline time.Time
+}
+
+// wait() sleeps before the next attempt, answering false if
+// there should be no next attempt.
+func (r *retrier) wait() bool {
+	if r.attempts >= r.opts.MaxAttempts {
+		return false
+	}
+	// Sleep for between half and all of the delay, so that
+	// clients failing together don't retry together.
+	d := r.delay/2 + time.Duration(rand.Int63n(int64(r.delay/2)+1))
+	if !r.deadline.IsZero() && time.Now().Add(d).After(r.deadline) {
+		return false
+	}
+	time.Sleep(d)
+	r.attempts++
+	r.delay *= 2
+	if r.delay > r.opts.MaxBackoff {
+		r.delay = r.opts.MaxBackoff
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package lid_test
+
+import (
+	"errors"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"testing"
+	"time"
+)
+
+// TestRetry verifies the retry middleware against a service that
+// fails transiently, sometimes after applying the request.
+func TestRetry(t *testing.T) {
+	ok := lid.LockResponse{Status: lid.LockOk}
+	cases := []struct {
+		Failures  int  // Number of calls that fail transiently
+		Applied   bool // True if failed calls still reach the service
+		Setup     *lid.LockRequest
+		Req       lid.LockRequest
+		Want      lid.LockResponse
+		WantErr   error
+		WantCalls int
+	}{
+		{0, false, nil, lid.LockRequest{Signature: "a", Signee: "0"}, ok, nil, 1},
+		{2, false, nil, lid.LockRequest{Signature: "a", Signee: "0"}, ok, nil, 3},
+		{5, false, nil, lid.LockRequest{Signature: "a", Signee: "0"}, lid.LockResponse{}, errTransient, 3},
+		// The first attempt acquired the lock but the response was lost,
+		// so the retry renews it and answers LockOk
+		{1, true, nil, lid.LockRequest{Signature: "a", Signee: "0"}, ok, nil, 2},
+		{1, true, &lid.LockRequest{Signature: "a", Signee: "1"}, lid.LockRequest{Signature: "a", Signee: "0", Level: 1}, ok, nil, 2},
+		// A retried renewal can't be told from that, so it's also LockOk
+		{1, true, &lid.LockRequest{Signature: "a", Signee: "0"}, lid.LockRequest{Signature: "a", Signee: "0"}, ok, nil, 2},
+		{1, false, &lid.LockRequest{Signature: "a", Signee: "0"}, lid.LockRequest{Signature: "a", Signee: "0"}, ok, nil, 2},
+		// A lost attempt that didn't apply is answered by the retry
+		{1, false, &lid.LockRequest{Signature: "a", Signee: "1"}, lid.LockRequest{Signature: "a", Signee: "0", Level: 1}, lid.LockResponse{Status: lid.LockTransferred, PreviousSignee: "1"}, nil, 2},
+		// Never retry a LockFailed
+		{0, false, &lid.LockRequest{Signature: "a", Signee: "1"}, lid.LockRequest{Signature: "a", Signee: "0"}, lid.LockResponse{Status: lid.LockFailed}, lid.ErrForbidden, 1},
+	}
+	for i, tc := range cases {
+		mem, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+		lid.MustErr(err)
+		if tc.Setup != nil {
+			mem.Lock(*tc.Setup, nil)
+		}
+		flaky := &flakyService{Service: mem, failures: tc.Failures, applied: tc.Applied}
+		s := lid.WithRetry(lid.RetryOpts{MaxAttempts: 3, Backoff: time.Millisecond})(flaky)
+
+		resp, err := s.Lock(tc.Req, nil)
+		if resp != tc.Want || err != tc.WantErr || flaky.calls != tc.WantCalls {
+			t.Fatal("case", i, "have", resp, err, flaky.calls, "want", tc.Want, tc.WantErr, tc.WantCalls)
+		}
+		// The lock is only checked before a retry.
+		if flaky.checks != tc.WantCalls-1 {
+			t.Fatal("case", i, "has", flaky.checks, "checks")
+		}
+	}
+}
+
+// TestRetryCheckFailure verifies a check that fails transiently is
+// tried again, rather than ending the retries.
+func TestRetryCheckFailure(t *testing.T) {
+	mem, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	flaky := &flakyService{Service: mem, failures: 1, checkFailures: 1}
+	s := lid.WithRetry(lid.RetryOpts{MaxAttempts: 3, Backoff: time.Millisecond})(flaky)
+
+	resp, err := s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	if resp.Status != lid.LockOk || err != nil || flaky.calls != 2 || flaky.checks != 2 {
+		t.Fatal("have", resp, err, flaky.calls, flaky.checks)
+	}
+}
+
+// TestRetryUnlock verifies retried unlocks against a service that
+// fails transiently, sometimes after applying the request.
+func TestRetryUnlock(t *testing.T) {
+	cases := []struct {
+		Failures  int
+		Applied   bool
+		Locked    bool // True if the lock is held by the signee first
+		Want      lid.UnlockResponseStatus
+		WantCalls int
+	}{
+		{1, false, true, lid.UnlockOk, 2},
+		// A lock that's gone is answered as unlocked, without a retry
+		{1, false, false, lid.UnlockOk, 1},
+		// The first attempt unlocked but the response was lost
+		{1, true, true, lid.UnlockOk, 1},
+	}
+	for i, tc := range cases {
+		mem, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+		lid.MustErr(err)
+		if tc.Locked {
+			mem.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+		}
+		flaky := &flakyService{Service: mem, failures: tc.Failures, applied: tc.Applied}
+		s := lid.WithRetry(lid.RetryOpts{MaxAttempts: 3, Backoff: time.Millisecond})(flaky)
+
+		resp, err := s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, nil)
+		if resp.Status != tc.Want || err != nil || flaky.calls != tc.WantCalls {
+			t.Fatal("case", i, "have", resp.Status, err, flaky.calls, "want", tc.Want, tc.WantCalls)
+		}
+	}
+}
+
+// TestRetryBudget verifies retrying stops when the budget is spent.
+func TestRetryBudget(t *testing.T) {
+	mem, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	flaky := &flakyService{Service: mem, failures: 100}
+	opts := lid.RetryOpts{MaxAttempts: 100, Backoff: 20 * time.Millisecond, Budget: 50 * time.Millisecond}
+	s := lid.WithRetry(opts)(flaky)
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	if err != errTransient || flaky.calls > 4 {
+		t.Fatal("have", err, flaky.calls)
+	}
+}
+
+// ------------------------------------------------------------
+// FLAKY-SERVICE
+
+// flakyService fails the first calls to Lock and Unlock, and then
+// the first calls to Check, with a transient error.
+type flakyService struct {
+	lid.Service
+	failures      int
+	applied       bool
+	calls         int
+	checkFailures int
+	checks        int
+}
+
+func (s *flakyService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	s.calls++
+	if s.calls > s.failures {
+		return s.Service.Lock(req, opts)
+	}
+	if s.applied {
+		s.Service.Lock(req, opts)
+	}
+	return lid.LockResponse{}, errTransient
+}
+
+func (s *flakyService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	s.calls++
+	if s.calls > s.failures {
+		return s.Service.Unlock(req, opts)
+	}
+	if s.applied {
+		s.Service.Unlock(req, opts)
+	}
+	return lid.UnlockResponse{}, errTransient
+}
+
+func (s *flakyService) Check(signature string) (lid.CheckResponse, error) {
+	s.checks++
+	if s.checks <= s.checkFailures {
+		return lid.CheckResponse{}, errTransient
+	}
+	return s.Service.Check(signature)
+}
+
+var (
+	errTransient = lid.NewTransientError(errors.New("Throttled"))
+)
@@ -18,8 +18,9 @@ type scriptResponse struct {
 // command found in the script. Answer an error if anything
 // goes wrong with preparing the script, but note that I do not
 // answer an error from running a command, all output is captured
-// by the script response.
-func runScript(_script interface{}, s Service) (scriptResponse, error) {
+// by the script response. The clock is advanced by the script's
+// advance commands, and can be nil if there are none.
+func runScript(_script interface{}, s Service, clock *FakeClock) (scriptResponse, error) {
 	resp := scriptResponse{}
 	script, ok := _script.(string)
 	if !ok {
@@ -35,7 +36,7 @@ func runScript(_script interface{}, s Service) (scriptResponse, error) {
 			return resp, err
 		}
 		for k, v := range m {
-			r, e := runScriptCommand(k, v, s)
+			r, e := runScriptCommand(k, v, s, clock)
 			if e != nil {
 				return resp, e
 			}
@@ -47,20 +48,36 @@ func runScript(_script interface{}, s Service) (scriptResponse, error) {
 	return resp, nil
 }
 
-func runScriptCommand(command string, script interface{}, s Service) ([]interface{}, error) {
+func runScriptCommand(command string, script interface{}, s Service, clock *FakeClock) ([]interface{}, error) {
 	switch command {
+	case advCmd:
+		return runScriptAdv(script, clock)
 	case checkCmd:
 		return runScriptCheck(script, s)
 	case durCmd:
 		return runScriptDur(script, s)
 	case lockCmd:
 		return runScriptLock(script, s)
+	case sweepCmd:
+		return runScriptSweep(s)
 	case unlockCmd:
 		return runScriptUnlock(script, s)
 	}
 	return nil, errors.New("Unknown script command (" + command + ")")
 }
 
+func runScriptAdv(script interface{}, clock *FakeClock) ([]interface{}, error) {
+	if clock == nil {
+		return nil, errors.New("runScriptAdv() with no clock")
+	}
+	d, ok := script.(float64) // the JSON encoder sets the number to a float
+	if !ok {
+		return nil, errors.New("runScriptAdv() on invalid duration")
+	}
+	clock.Advance(time.Duration(int64(d)))
+	return nil, nil
+}
+
 func runScriptCheck(script interface{}, s Service) ([]interface{}, error) {
 	var signature string
 	err := readScriptJSON(script, "/sig", &signature)
@@ -99,6 +116,14 @@ func runScriptLock(script interface{}, s Service) ([]interface{}, error) {
 	return []interface{}{resp, err}, nil
 }
 
+// runScriptSweep() sweeps the service, if it sweeps.
+func runScriptSweep(s Service) ([]interface{}, error) {
+	if sd, ok := s.(ServiceSweepDebug); ok {
+		sd.Sweep()
+	}
+	return nil, nil
+}
+
 func runScriptUnlock(script interface{}, s Service) ([]interface{}, error) {
 	req := UnlockRequest{}
 	err := readScriptJSON(script, "/req", &req)
@@ -129,8 +154,10 @@ func readScriptJSON(src interface{}, path string, dst interface{}) error {
 // CONST and VAR
 
 const (
+	advCmd    = "adv"
 	checkCmd  = "c"
 	durCmd    = "dur"
 	lockCmd   = "l"
+	sweepCmd  = "sweep"
 	unlockCmd = "u"
 )
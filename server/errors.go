@@ -0,0 +1,13 @@
+package lidserver
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errMethodNotAllowed = errors.New("Method not allowed")
+	errNotFound         = errors.New("Not found")
+)
@@ -0,0 +1,176 @@
+package lidserver
+
+import (
+	"encoding/json"
+	"github.com/hackborn/lid"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// HANDLER
+
+// NewHandler answers an http.Handler exposing the service as HTTP/JSON:
+// * POST /locks/{sig} locks. The body is a LockBody.
+// * DELETE /locks/{sig} unlocks. The body is an UnlockRequest, or the
+// signee is in the "signee" query parameter.
+// * GET /locks/{sig} checks.
+// The signature in the path must be escaped, and overrides any in the body.
+// Responses are the JSON of the lid response types. Errors are an
+// ErrorBody with the status code from StatusCode.
+func NewHandler(s lid.Service) http.Handler {
+	return &handler{service: s}
+}
+
+type handler struct {
+	service lid.Service
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := signature(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		h.lock(w, r, sig)
+	case http.MethodDelete:
+		h.unlock(w, r, sig)
+	case http.MethodGet:
+		h.check(w, r, sig)
+	default:
+		w.Header().Set("Allow", "DELETE, GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	}
+}
+
+func (h *handler) lock(w http.ResponseWriter, r *http.Request, sig string) {
+	body := LockBody{}
+	if !readBody(w, r, &body) {
+		return
+	}
+	body.Signature = sig
+	opts := body.Opts
+	if opts == nil {
+		opts = &lid.LockOpts{}
+	}
+	opts.Context = r.Context()
+	resp, err := h.service.Lock(body.LockRequest, opts)
+	writeResponse(w, resp, err)
+}
+
+func (h *handler) unlock(w http.ResponseWriter, r *http.Request, sig string) {
+	req := lid.UnlockRequest{Signee: r.URL.Query().Get(signeeParam)}
+	if req.Signee == "" && !readBody(w, r, &req) {
+		return
+	}
+	req.Signature = sig
+	resp, err := h.service.Unlock(req, &lid.UnlockOpts{Context: r.Context()})
+	writeResponse(w, resp, err)
+}
+
+func (h *handler) check(w http.ResponseWriter, r *http.Request, sig string) {
+	resp, err := h.service.Check(sig)
+	writeResponse(w, resp, err)
+}
+
+// ------------------------------------------------------------
+// BODIES
+
+// LockBody is the body of a lock request.
+type LockBody struct {
+	lid.LockRequest
+	Opts *lid.LockOpts `json:"opts,omitempty"`
+}
+
+// ErrorBody is the body of an error response.
+type ErrorBody struct {
+	Error string `json:"error,omitempty"`
+}
+
+// ------------------------------------------------------------
+// STATUS
+
+// StatusCode answers the HTTP status for an error from a lid.Service.
+func StatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case err == lid.ErrBadRequest:
+		return http.StatusBadRequest
+	case err == lid.ErrNotFound:
+		return http.StatusNotFound
+	case err == lid.ErrClockSkew:
+		return http.StatusServiceUnavailable
+	case lid.IsTransient(err):
+		return http.StatusServiceUnavailable
+	}
+	if e, ok := err.(*lid.Error); ok && e.Code == lid.Forbidden {
+		return http.StatusConflict
+	}
+	// Backends answer plain errors for bad requests they detect themselves.
+	if strings.HasPrefix(err.Error(), badRequestPrefix) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+// signature() answers the unescaped signature from the request path.
+func signature(r *http.Request) (string, error) {
+	p := r.URL.EscapedPath()
+	if !strings.HasPrefix(p, LocksPath) || len(p) == len(LocksPath) {
+		return "", errNotFound
+	}
+	p = p[len(LocksPath):]
+	if strings.Contains(p, "/") {
+		return "", errNotFound
+	}
+	return url.PathUnescape(p)
+}
+
+func readBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Body == nil || r.ContentLength == 0 {
+		return true
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	writeJson(w, http.StatusOK, v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJson(w, code, ErrorBody{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// LocksPath is the path of the lock resources.
+	LocksPath = "/locks/"
+
+	badRequestPrefix = "Bad request"
+	maxBodySize      = 1 << 16
+	signeeParam      = "signee"
+)
@@ -0,0 +1,56 @@
+package lidserver
+
+import (
+	"encoding/json"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHandler verifies the raw HTTP interface, as a client
+// in another language would use it.
+func TestHandler(t *testing.T) {
+	ms, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	h := NewHandler(ms)
+
+	cases := []struct {
+		Method   string
+		Path     string
+		Body     string
+		WantCode int
+		WantBody string
+	}{
+		{"POST", "/locks/a%2Fb", `{"signee":"0","level":1}`, http.StatusOK, `{"status":1}`},
+		{"POST", "/locks/a%2Fb", `{"signee":"1","level":1}`, http.StatusConflict, `{"error":"Forbidden"}`},
+		{"POST", "/locks/a%2Fb", `{"signee":"1","level":2}`, http.StatusOK, `{"status":2,"previous_signee":"0"}`},
+		{"GET", "/locks/a%2Fb", ``, http.StatusOK, `{"signee":"1","level":2}`},
+		{"DELETE", "/locks/a%2Fb?signee=0", ``, http.StatusConflict, `{"error":"Forbidden"}`},
+		{"DELETE", "/locks/a%2Fb", `{"signee":"1"}`, http.StatusOK, `{"status":1}`},
+		{"GET", "/locks/a%2Fb", ``, http.StatusNotFound, `{"error":"Not found"}`},
+		{"POST", "/locks/a", `{"level":1}`, http.StatusBadRequest, `{"error":"Bad request"}`},
+		{"POST", "/locks/a", `{"signee":`, http.StatusBadRequest, ``},
+		{"GET", "/locks/", ``, http.StatusNotFound, ``},
+		{"GET", "/locks/a/b", ``, http.StatusNotFound, ``},
+		{"PUT", "/locks/a", ``, http.StatusMethodNotAllowed, ``},
+	}
+	for i, tc := range cases {
+		r := httptest.NewRequest(tc.Method, tc.Path, strings.NewReader(tc.Body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.WantCode {
+			t.Fatal("case", i, "expected code", tc.WantCode, "but have", w.Code, w.Body.String())
+		}
+		body := ErrorBody{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal("case", i, "expected a JSON body but have", w.Body.String())
+		}
+		if tc.WantBody != "" && strings.TrimSpace(w.Body.String()) != tc.WantBody {
+			t.Fatal("case", i, "expected body", tc.WantBody, "but have", w.Body.String())
+		}
+	}
+}
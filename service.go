@@ -43,3 +43,15 @@ type Service interface {
 type ServiceDebug interface {
 	SetDuration(time.Duration)
 }
+
+// ServiceClockDebug is implemented during testing by services that
+// can replace their clock, so expiry can be tested without waiting.
+type ServiceClockDebug interface {
+	SetClock(Clock)
+}
+
+// ServiceSweepDebug is implemented during testing by services that
+// delete records in the background, to delete them now.
+type ServiceSweepDebug interface {
+	Sweep()
+}
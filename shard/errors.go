@@ -0,0 +1,13 @@
+package lidshard
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errBadShard       = errors.New("Bad request: Shards need a unique name and a service")
+	errShardsRequired = errors.New("Bad request: Shards required")
+)
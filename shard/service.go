@@ -0,0 +1,230 @@
+package lidshard
+
+import (
+	"github.com/hackborn/lid"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ------------------------------------------------------------
+// SHARD
+
+// Shard is one of the services a sharded service spreads locks over.
+type Shard struct {
+	// Name identifies the shard on the hash ring. It must be unique and
+	// stable: renaming a shard relocates its locks.
+	Name    string
+	Service lid.Service
+}
+
+// ShardOpts provides options for the sharded service.
+type ShardOpts struct {
+	// VirtualNodes is the number of points each shard has on the hash
+	// ring. More points spread locks more evenly. Defaults to 128.
+	VirtualNodes int
+	// Previous, if set, enables migration mode. Previous are the shards
+	// before rebalancing; see NewService.
+	Previous []Shard
+}
+
+// ------------------------------------------------------------
+// SHARD-SERVICE
+
+// shardService provides a lid.Service that spreads signatures over
+// shards with consistent hashing, so adding or removing a shard only
+// relocates the locks on that shard's part of the ring.
+type shardService struct {
+	ring     *ring
+	previous *ring
+}
+
+// NewService constructs a new service on the shards.
+//
+// To rebalance, first move every client to migration mode, with the new
+// shards and the old ones in Previous. In migration mode a lock whose
+// shard changes is taken on its old shard, then its new shard, and held
+// on both, so it conflicts with clients on either layout. Once no client
+// uses the old layout and the lock duration has passed, move every client
+// to the new shards alone.
+func NewService(shards []Shard, opts ShardOpts) (lid.Service, error) {
+	return _newService(shards, opts)
+}
+
+func _newService(shards []Shard, opts ShardOpts) (*shardService, error) {
+	if opts.VirtualNodes < 1 {
+		opts.VirtualNodes = defaultVirtualNodes
+	}
+	r, err := newRing(shards, opts.VirtualNodes)
+	if err != nil {
+		return nil, err
+	}
+	s := &shardService{ring: r}
+	if len(opts.Previous) > 0 {
+		s.previous, err = newRing(opts.Previous, opts.VirtualNodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *shardService) Lock(req lid.LockRequest, opts *lid.LockOpts) (lid.LockResponse, error) {
+	if !req.IsValid() {
+		return lid.LockResponse{}, lid.ErrBadRequest
+	}
+	cur, old := s.locate(req.Signature)
+	if old == nil {
+		return cur.Service.Lock(req, opts)
+	}
+
+	// Migrating: the old shard first, so I never hold the new
+	// shard while a client on the old layout holds the old.
+	oldResp, err := old.Service.Lock(req, opts)
+	if err != nil {
+		return oldResp, err
+	}
+	resp, err := cur.Service.Lock(req, opts)
+	if err != nil {
+		// Release what I took on the old shard, but not a lock I already held.
+		if oldResp.Status != lid.LockRenewed {
+			old.Service.Unlock(lid.UnlockRequest{Signature: req.Signature, Signee: req.Signee}, unlockOpts(opts))
+		}
+		return resp, err
+	}
+	// Every migrating lock is also on the old shard, so the old shard
+	// knows the latest owner, including clients on the old layout.
+	if oldResp.Status == lid.LockTransferred {
+		resp = oldResp
+	}
+	return resp, nil
+}
+
+func (s *shardService) Unlock(req lid.UnlockRequest, opts *lid.UnlockOpts) (lid.UnlockResponse, error) {
+	if !req.IsValid() {
+		return lid.UnlockResponse{}, lid.ErrBadRequest
+	}
+	cur, old := s.locate(req.Signature)
+	if old == nil {
+		return cur.Service.Unlock(req, opts)
+	}
+
+	// Migrating: release the new shard first, the reverse of locking.
+	resp, err := cur.Service.Unlock(req, opts)
+	oldResp, oldErr := old.Service.Unlock(req, opts)
+	if err != nil {
+		return resp, err
+	}
+	if oldErr != nil {
+		return oldResp, oldErr
+	}
+	if oldResp.Status == lid.UnlockOk {
+		resp.Status = lid.UnlockOk
+	}
+	return resp, nil
+}
+
+// Check() answers the state of a the requested lock. An error is answered
+// if the lock doesn't exist.
+// DO NOT USE THIS FUNCTION. It doesn't have much value, but exists as
+// I transition a service to this library.
+func (s *shardService) Check(signature string) (lid.CheckResponse, error) {
+	if signature == "" {
+		return lid.CheckResponse{}, lid.ErrBadRequest
+	}
+	cur, old := s.locate(signature)
+	if old == nil {
+		return cur.Service.Check(signature)
+	}
+	// Migrating: the old shard knows the latest owner, as when locking.
+	resp, err := old.Service.Check(signature)
+	if err == lid.ErrNotFound {
+		return cur.Service.Check(signature)
+	}
+	return resp, err
+}
+
+// locate() answers the signature's shard, and its previous shard
+// if I'm migrating and it has moved.
+func (s *shardService) locate(signature string) (*Shard, *Shard) {
+	cur := s.ring.locate(signature)
+	if s.previous == nil {
+		return cur, nil
+	}
+	old := s.previous.locate(signature)
+	if old.Name == cur.Name {
+		return cur, nil
+	}
+	return cur, old
+}
+
+// ------------------------------------------------------------
+// RING
+
+// ring is a consistent hash ring of shards.
+type ring struct {
+	points []uint64
+	shards map[uint64]*Shard
+}
+
+func newRing(shards []Shard, virtualNodes int) (*ring, error) {
+	if len(shards) < 1 {
+		return nil, errShardsRequired
+	}
+	r := &ring{shards: make(map[uint64]*Shard)}
+	names := make(map[string]bool)
+	for i := range shards {
+		shard := &shards[i]
+		if shard.Name == "" || shard.Service == nil || names[shard.Name] {
+			return nil, errBadShard
+		}
+		names[shard.Name] = true
+		for v := 0; v < virtualNodes; v++ {
+			p := hash(shard.Name + "#" + strconv.Itoa(v))
+			// A collision goes to the lesser name, so the ring doesn't depend on order.
+			if prev, ok := r.shards[p]; ok {
+				if prev.Name < shard.Name {
+					continue
+				}
+			} else {
+				r.points = append(r.points, p)
+			}
+			r.shards[p] = shard
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r, nil
+}
+
+// locate() answers the shard owning the first point at or after the signature.
+func (r *ring) locate(signature string) *Shard {
+	h := hash(signature)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[r.points[i]]
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func unlockOpts(opts *lid.LockOpts) *lid.UnlockOpts {
+	if opts != nil {
+		return &lid.UnlockOpts{Context: opts.Context}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultVirtualNodes = 128
+)
@@ -0,0 +1,177 @@
+package lidshard
+
+import (
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestRebalance verifies signatures spread evenly, and adding
+// a shard only relocates signatures to the new shard.
+func TestRebalance(t *testing.T) {
+	before, err := newRing(makeShards(lid.SystemClock, 4), defaultVirtualNodes)
+	lid.MustErr(err)
+	after, err := newRing(makeShards(lid.SystemClock, 5), defaultVirtualNodes)
+	lid.MustErr(err)
+
+	const count = 10000
+	counts := make(map[string]int)
+	moved := 0
+	for i := 0; i < count; i++ {
+		sig := "sig" + strconv.Itoa(i)
+		a, b := before.locate(sig), after.locate(sig)
+		counts[a.Name]++
+		if a.Name != b.Name {
+			moved++
+			if b.Name != "4" {
+				t.Fatal("expected", sig, "to move to the new shard but it moved to", b.Name)
+			}
+		}
+	}
+	for name, n := range counts {
+		if n < count/4*7/10 || n > count/4*13/10 {
+			t.Fatal("expected an even spread but shard", name, "has", n)
+		}
+	}
+	if moved < count/5*7/10 || moved > count/5*13/10 {
+		t.Fatal("expected about a fifth of the signatures to move but have", moved)
+	}
+}
+
+// TestMigration verifies a client in migration mode respects
+// locks held on either layout.
+func TestMigration(t *testing.T) {
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	shards := makeShards(clock, 5)
+	oldLayout, err := NewService(shards[:4], ShardOpts{})
+	lid.MustErr(err)
+	newLayout, err := NewService(shards, ShardOpts{})
+	lid.MustErr(err)
+	migrating, err := NewService(shards, ShardOpts{Previous: shards[:4]})
+	lid.MustErr(err)
+
+	// Find a signature that moves.
+	r, _ := newRing(shards[:4], defaultVirtualNodes)
+	sig := ""
+	for i := 0; sig == ""; i++ {
+		if s := "sig" + strconv.Itoa(i); r.locate(s).Name != "4" && newLayout.(*shardService).ring.locate(s).Name == "4" {
+			sig = s
+		}
+	}
+
+	// A lock on the old layout blocks the migrating client.
+	_, err = oldLayout.Lock(lid.LockRequest{Signature: sig, Signee: "old"}, nil)
+	lid.MustErr(err)
+	if _, err = migrating.Lock(lid.LockRequest{Signature: sig, Signee: "m"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the old layout's lock to block but have", err)
+	}
+	if check, err := migrating.Check(sig); err != nil || check.Signee != "old" {
+		t.Fatal("expected to see the old layout's lock but have", check, err)
+	}
+	if _, err = newLayout.Check(sig); err != lid.ErrNotFound {
+		t.Fatal("expected the failed lock to leave the new shard free but have", err)
+	}
+	_, err = oldLayout.Unlock(lid.UnlockRequest{Signature: sig, Signee: "old"}, nil)
+	lid.MustErr(err)
+
+	// A migrating lock blocks both layouts.
+	resp, err := migrating.Lock(lid.LockRequest{Signature: sig, Signee: "m"}, nil)
+	if err != nil || resp.Status != lid.LockOk {
+		t.Fatal("expected the lock but have", resp.Status, err)
+	}
+	if _, err = oldLayout.Lock(lid.LockRequest{Signature: sig, Signee: "old"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the old layout to be blocked but have", err)
+	}
+	if _, err = newLayout.Lock(lid.LockRequest{Signature: sig, Signee: "new"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the new layout to be blocked but have", err)
+	}
+
+	// Transfers report the owner from the old layout.
+	clock.Advance(time.Minute)
+	_, err = oldLayout.Lock(lid.LockRequest{Signature: sig, Signee: "old"}, nil)
+	lid.MustErr(err)
+	clock.Advance(time.Minute)
+	resp, err = migrating.Lock(lid.LockRequest{Signature: sig, Signee: "m2"}, nil)
+	if err != nil || resp.Status != lid.LockTransferred || resp.PreviousSignee != "old" {
+		t.Fatal("expected a transfer from the old layout but have", resp, err)
+	}
+
+	uresp, err := migrating.Unlock(lid.UnlockRequest{Signature: sig, Signee: "m2"}, nil)
+	if err != nil || uresp.Status != lid.UnlockOk {
+		t.Fatal("expected the unlock but have", uresp.Status, err)
+	}
+	if _, err = oldLayout.Check(sig); err != lid.ErrNotFound {
+		t.Fatal("expected the old shard released but have", err)
+	}
+
+	// The old shard is checked first, and a lock that fails on the new
+	// shard releases the lock it transferred on the old.
+	_, err = oldLayout.Lock(lid.LockRequest{Signature: sig, Signee: "old"}, nil)
+	lid.MustErr(err)
+	clock.Advance(time.Minute)
+	_, err = newLayout.Lock(lid.LockRequest{Signature: sig, Signee: "new"}, nil)
+	lid.MustErr(err)
+	if check, err := migrating.Check(sig); err != nil || check.Signee != "old" {
+		t.Fatal("expected to see the old shard's lock but have", check, err)
+	}
+	if _, err = migrating.Lock(lid.LockRequest{Signature: sig, Signee: "m3"}, nil); err != lid.ErrForbidden {
+		t.Fatal("expected the new layout's lock to block but have", err)
+	}
+	if _, err = oldLayout.Check(sig); err != lid.ErrNotFound {
+		t.Fatal("expected the transferred lock released but have", err)
+	}
+}
+
+func makeShards(clock lid.Clock, count int) []Shard {
+	var shards []Shard
+	for i := 0; i < count; i++ {
+		s, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock})
+		lid.MustErr(err)
+		shards = append(shards, Shard{Name: strconv.Itoa(i), Service: s})
+	}
+	return shards
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type shardServiceBootstrap struct {
+	migrating bool
+}
+
+func (b *shardServiceBootstrap) OpenService() lid.Service {
+	clock := lid.NewDebugClock()
+	shards := makeShards(clock, 4)
+	opts := ShardOpts{}
+	if b.migrating {
+		// Shrinking moves the last shard's signatures to the others.
+		opts.Previous = shards
+		shards = shards[:3]
+	}
+	service, err := _newService(shards, opts)
+	lid.MustErr(err)
+	return lid.NewDebugWrapper(service, clock)
+}
+
+func (b *shardServiceBootstrap) CloseService() error {
+	return nil
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	services = append(services, &shardServiceBootstrap{})
+	services = append(services, &shardServiceBootstrap{migrating: true})
+	return services
+}
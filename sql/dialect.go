@@ -0,0 +1,130 @@
+package lidsql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// DIALECT
+
+// Dialect identifies the flavour of SQL spoken by the database.
+type Dialect int
+
+// The supported dialects.
+const (
+	Postgres Dialect = iota + 1
+	MySQL
+	SQLite
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	case SQLite:
+		return "sqlite"
+	}
+	return "Dialect(" + strconv.Itoa(int(d)) + ")"
+}
+
+// statements holds the SQL for a table in a dialect.
+type statements struct {
+	createTable string
+	addColumns  string // Adds columns missing from an older table. Optional.
+	dropTable   string
+	upsertLock  string // Postgres. Args: signature, signee, level, expires, ttl, expired
+	selectLock  string // Args: signature
+	insertLock  string // Args: signature, signee, level, expires, ttl
+	updateLock  string // Args: signee, level, expires, ttl, signature
+	deleteLock  string // Args: signature, signee
+	existsLock  string // Args: signature
+	checkLock   string // Args: signature
+	reapLocks   string // Args: now (epoch seconds)
+}
+
+// newStatements() answers the statements for the table in my dialect.
+func (d Dialect) newStatements(table string) (statements, error) {
+	columns := sigCol + ` VARCHAR(255) NOT NULL PRIMARY KEY, ` +
+		signeeCol + ` VARCHAR(255) NOT NULL, ` +
+		levelCol + ` INTEGER NOT NULL, ` +
+		expiresCol + ` BIGINT NOT NULL, ` +
+		ttlCol + ` BIGINT NOT NULL DEFAULT 0`
+	s := statements{
+		dropTable:  `DROP TABLE IF EXISTS ` + table,
+		selectLock: `SELECT ` + signeeCol + `, ` + levelCol + `, ` + expiresCol + ` FROM ` + table + ` WHERE ` + sigCol + ` = ?`,
+		insertLock: `INSERT INTO ` + table + ` (` + sigCol + `, ` + signeeCol + `, ` + levelCol + `, ` + expiresCol + `, ` + ttlCol + `) VALUES (?, ?, ?, ?, ?)`,
+		updateLock: `UPDATE ` + table + ` SET ` + signeeCol + ` = ?, ` + levelCol + ` = ?, ` + expiresCol + ` = ?, ` + ttlCol + ` = ? WHERE ` + sigCol + ` = ?`,
+		deleteLock: `DELETE FROM ` + table + ` WHERE ` + sigCol + ` = ? AND ` + signeeCol + ` = ?`,
+		existsLock: `SELECT 1 FROM ` + table + ` WHERE ` + sigCol + ` = ?`,
+		checkLock:  `SELECT ` + signeeCol + `, ` + levelCol + ` FROM ` + table + ` WHERE ` + sigCol + ` = ?`,
+		reapLocks:  `DELETE FROM ` + table + ` WHERE ` + ttlCol + ` > 0 AND ` + ttlCol + ` < ?`,
+	}
+
+	switch d {
+	case Postgres:
+		// A single conditional upsert, mirroring the DynamoDB backend's
+		// acquire condition. It records the owner it replaced and answers
+		// it, so a lock that races a first lock still reports correctly.
+		prev := prevCol + ` VARCHAR(255) NOT NULL DEFAULT ''`
+		s.createTable = `CREATE TABLE IF NOT EXISTS ` + table + ` (` + columns + `, ` + prev + `)`
+		s.addColumns = `ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS ` + prev
+		s.upsertLock = `INSERT INTO ` + table + ` (` + sigCol + `, ` + signeeCol + `, ` + levelCol + `, ` + expiresCol + `, ` + ttlCol + `, ` + prevCol + `) VALUES (?, ?, ?, ?, ?, '')` +
+			` ON CONFLICT (` + sigCol + `) DO UPDATE SET ` +
+			signeeCol + ` = excluded.` + signeeCol + `, ` +
+			levelCol + ` = excluded.` + levelCol + `, ` +
+			expiresCol + ` = excluded.` + expiresCol + `, ` +
+			ttlCol + ` = excluded.` + ttlCol + `, ` +
+			prevCol + ` = ` + table + `.` + signeeCol +
+			` WHERE ` + table + `.` + signeeCol + ` = excluded.` + signeeCol +
+			` OR ` + table + `.` + levelCol + ` < excluded.` + levelCol +
+			` OR ` + table + `.` + expiresCol + ` < ?` +
+			` RETURNING ` + prevCol
+	case MySQL:
+		// The lock is read with its row locked, then decided and written.
+		s.createTable = `CREATE TABLE IF NOT EXISTS ` + table + ` (` + columns + `)`
+		s.selectLock += ` FOR UPDATE`
+	case SQLite:
+		// SQLite has a single writer, so the read and write can't race.
+		s.createTable = `CREATE TABLE IF NOT EXISTS ` + table + ` (` + columns + `)`
+	default:
+		return s, errDialectRequired
+	}
+
+	if d == Postgres {
+		for _, stmt := range []*string{&s.upsertLock, &s.selectLock, &s.insertLock, &s.updateLock, &s.deleteLock, &s.existsLock, &s.checkLock, &s.reapLocks} {
+			*stmt = numberPlaceholders(*stmt)
+		}
+	}
+	return s, nil
+}
+
+// numberPlaceholders() converts ? placeholders to Postgres' $1, $2...
+func numberPlaceholders(stmt string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range stmt {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+// The lock table columns, named to match the DynamoDB backend.
+const (
+	sigCol     = "lsig"
+	signeeCol  = "lsignee"
+	levelCol   = "llevel"
+	expiresCol = "lexpires"
+	ttlCol     = "lttl"
+	prevCol    = "lprev" // Postgres. The owner the last lock replaced.
+)
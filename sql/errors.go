@@ -0,0 +1,15 @@
+package lidsql
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	errDatabaseRequired = errors.New("Database is required")
+	errDialectRequired  = errors.New("Bad request: Dialect required")
+	errDurationRequired = errors.New("Bad request: Duration required")
+	errTableInvalid     = errors.New("Bad request: Table name must be a plain identifier")
+)
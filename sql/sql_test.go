@@ -0,0 +1,125 @@
+package lidsql
+
+import (
+	"database/sql"
+	"github.com/hackborn/lid"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestService provides scripted testing for the service, allowing
+// chained command lists. It's a little painful to write tests, but there
+// isn't much value in testing a single locking function.
+func TestService(t *testing.T) {
+	suites := makeTestServices(t)
+
+	lid.RunTestServiceSuite(t, suites)
+}
+
+// TestStatements verifies the dialects produce the placeholders they expect.
+func TestStatements(t *testing.T) {
+	for _, d := range []Dialect{Postgres, MySQL, SQLite} {
+		s, err := d.newStatements("locks")
+		lid.MustErr(err)
+		if d == Postgres && (strings.Contains(s.upsertLock, "?") || !strings.Contains(s.upsertLock, "$6") || !strings.Contains(s.updateLock, "$5")) {
+			t.Fatal("bad postgres placeholders in", s.upsertLock, s.updateLock)
+		}
+		if d != Postgres && (s.upsertLock != "" || strings.Count(s.updateLock, "?") != 5) {
+			t.Fatal("bad", d, "placeholders in", s.updateLock)
+		}
+		if strings.Contains(s.upsertLock, "@") {
+			t.Fatal("user variable in", s.upsertLock)
+		}
+	}
+	if _, err := Dialect(0).newStatements("locks"); err != errDialectRequired {
+		t.Fatal("expected a dialect error")
+	}
+}
+
+// TestReap verifies a lock deletes the records past their time to live.
+func TestReap(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "locks.db"))
+	lid.MustErr(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	clock := lid.NewFakeClock(time.Unix(1000, 0))
+	s, err := _newService(lid.ServiceOpts{Duration: time.Second * 10, Clock: clock}, db, SQLite)
+	lid.MustErr(err)
+
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, &lid.LockOpts{TimeToLive: time.Second * 30})
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "b", Signee: "0"}, nil)
+	lid.MustErr(err)
+	clock.Advance(reapInterval + time.Second)
+	_, err = s.Lock(lid.LockRequest{Signature: "c", Signee: "0"}, nil)
+	lid.MustErr(err)
+	if _, err = s.Check("a"); err != lid.ErrNotFound {
+		t.Fatal("expected the record reaped but have", err)
+	}
+	if _, err = s.Check("b"); err != nil {
+		t.Fatal("expected the record without a time to live kept but have", err)
+	}
+}
+
+// TestOpen verifies constructing the service from a URL.
+func TestOpen(t *testing.T) {
+	path := filepath.ToSlash(filepath.Join(t.TempDir(), "locks.db"))
+	s, err := lid.Open("sqlite://" + path + "?duration=10s&table=locks")
+	lid.MustErr(err)
+	_, err = s.Lock(lid.LockRequest{Signature: "a", Signee: "0"}, nil)
+	lid.MustErr(err)
+	resp, err := s.Check("a")
+	if err != nil || resp.Signee != "0" {
+		t.Fatal("have", resp, err)
+	}
+}
+
+// ------------------------------------------------------------
+// SERVICE DEBUG
+
+func (s *sqlService) SetDuration(d time.Duration) {
+	s.opts.Duration = d
+}
+
+func (s *sqlService) SetClock(c lid.Clock) {
+	s.opts.Clock = c
+}
+
+// ------------------------------------------------------------
+// TEST-CFG
+
+type sqliteServiceBootstrap struct {
+	dir     string
+	db      *sql.DB
+	service *sqlService
+}
+
+func (b *sqliteServiceBootstrap) OpenService() lid.Service {
+	db, err := sql.Open("sqlite", filepath.Join(b.dir, "locks.db"))
+	lid.MustErr(err)
+	// SQLite allows a single writer.
+	db.SetMaxOpenConns(1)
+	opts := lid.ServiceOpts{Duration: time.Second * 10}
+	service, err := _newService(opts, db, SQLite)
+	lid.MustErr(err)
+	b.db = db
+	b.service = service
+	return service
+}
+
+func (b *sqliteServiceBootstrap) CloseService() error {
+	err := b.service.deleteTable()
+	b.service = nil
+	return lid.MergeErr(err, b.db.Close())
+}
+
+// makeTestServices makes the test services for the testing configuration.
+func makeTestServices(t *testing.T) []lid.ServiceBootstrap {
+	var services []lid.ServiceBootstrap
+	bootstrap := &sqliteServiceBootstrap{dir: t.TempDir()}
+	services = append(services, bootstrap)
+	return services
+}
@@ -3,7 +3,9 @@ package lid
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/micro-go/lock"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -23,9 +25,15 @@ func RunTestServiceSuite(t *testing.T, suites []ServiceBootstrap) {
 		// Acquire existing lock through higher level
 		{buildScript(lreq("a", "0", 0, false), lreq("a", "1", 1, false)), buildResp(lresp(LockOk, "", nil), lresp(LockTransferred, "0", nil))},
 		// Renew my existing lock
-		{buildScript(durS(-20), lreq("a", "0", 0, false), durS(10), lreq("a", "0", 1, false)), buildResp(lresp(LockOk, "", nil), lresp(LockRenewed, "", nil))},
+		{buildScript(lreq("a", "0", 0, false), advS(20), lreq("a", "0", 1, false)), buildResp(lresp(LockOk, "", nil), lresp(LockRenewed, "", nil))},
 		// Acquire someone else's expired lock
-		{buildScript(durS(-20), lreq("a", "0", 0, false), durS(10), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockTransferred, "0", nil))},
+		{buildScript(lreq("a", "0", 0, false), advS(20), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockTransferred, "0", nil))},
+		// Acquire someone else's expired lock after a sweep, which keeps it
+		{buildScript(lreq("a", "0", 0, false), advS(20), sweep(), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockTransferred, "0", nil))},
+		// Fail acquiring someone else's lock that is about to expire
+		{buildScript(lreq("a", "0", 0, false), advS(9), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockFailed, "", ErrForbidden))},
+		// Acquire someone else's lock that expired early due to a short duration
+		{buildScript(durS(5), lreq("a", "0", 0, false), durS(10), advS(6), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockTransferred, "0", nil))},
 		// Fail acquiring existing, valid lock
 		{buildScript(lreq("a", "0", 0, false), lreq("a", "1", 0, false)), buildResp(lresp(LockOk, "", nil), lresp(LockFailed, "", ErrForbidden))},
 		// Unlock a missing lock
@@ -54,7 +62,13 @@ func runTestService(t *testing.T, b ServiceBootstrap, script string, wantResp sc
 	s := b.OpenService()
 	defer b.CloseService()
 
-	haveResp, err := runScript(script, s)
+	// Every case runs on a fake clock, so expiry is deterministic.
+	clock := NewFakeClock(time.Now())
+	if sd, ok := s.(ServiceClockDebug); ok {
+		sd.SetClock(clock)
+	}
+
+	haveResp, err := runScript(script, s, clock)
 	MustErr(err)
 	if !wantResp.equals(haveResp) {
 		fmt.Println("Mismatch have\n", haveResp, "\nwant\n", wantResp)
@@ -85,6 +99,13 @@ func check(signature string) interface{} {
 	return cmd
 }
 
+// advS creates a scripting object that advances the service clock.
+func advS(seconds int64) interface{} {
+	cmd := make(map[string]interface{})
+	cmd[advCmd] = time.Duration(seconds) * time.Second
+	return cmd
+}
+
 // durS creates a scripting object that applies a new duration to the service.
 func durS(seconds int64) interface{} {
 	cmd := make(map[string]interface{})
@@ -92,6 +113,13 @@ func durS(seconds int64) interface{} {
 	return cmd
 }
 
+// sweep creates a scripting object that sweeps the service.
+func sweep() interface{} {
+	cmd := make(map[string]interface{})
+	cmd[sweepCmd] = true
+	return cmd
+}
+
 // lreq returns a scripting object to create a lock request.
 func lreq(signature, signee string, level int, force bool) interface{} {
 	body := make(map[string]interface{})
@@ -184,3 +212,65 @@ type ServiceBootstrap interface {
 	OpenService() Service
 	CloseService() error
 }
+
+// ------------------------------------------------------------
+// DEBUG-WRAPPER
+
+// DebugWrapper adds ServiceDebug and ServiceClockDebug to a service
+// that can't change its duration or clock after construction, such as
+// a client or a service composed of others. The duration is sent as a
+// lock option, and the clock is swapped behind a DebugClock the service
+// was constructed on.
+type DebugWrapper struct {
+	Service
+	clock    *DebugClock
+	duration time.Duration
+}
+
+// NewDebugWrapper answers a DebugWrapper on the service, which was
+// constructed on the clock.
+func NewDebugWrapper(s Service, clock *DebugClock) *DebugWrapper {
+	return &DebugWrapper{Service: s, clock: clock}
+}
+
+func (s *DebugWrapper) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	if s.duration != 0 && (opts == nil || opts.Duration == 0) {
+		o := LockOpts{Duration: s.duration}
+		if opts != nil {
+			o = *opts
+			o.Duration = s.duration
+		}
+		opts = &o
+	}
+	return s.Service.Lock(req, opts)
+}
+
+func (s *DebugWrapper) SetDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *DebugWrapper) SetClock(c Clock) {
+	s.clock.Set(c)
+}
+
+// DebugClock forwards to a clock that can be replaced.
+type DebugClock struct {
+	mutex sync.Mutex
+	clock Clock
+}
+
+// NewDebugClock answers a new DebugClock forwarding to SystemClock.
+func NewDebugClock() *DebugClock {
+	return &DebugClock{clock: SystemClock}
+}
+
+func (c *DebugClock) Now() time.Time {
+	defer lock.Locker(&c.mutex).Unlock()
+	return c.clock.Now()
+}
+
+// Set forwards to the clock.
+func (c *DebugClock) Set(clock Clock) {
+	defer lock.Locker(&c.mutex).Unlock()
+	c.clock = clock
+}
@@ -0,0 +1,253 @@
+package lid
+
+import (
+	"context"
+	"github.com/micro-go/lock"
+	"sync"
+	"time"
+)
+
+// ------------------------------------------------------------
+// TRACER
+
+// Tracer creates spans. It is deliberately small so it can be
+// adapted to OpenTelemetry or any other tracing system.
+type Tracer interface {
+	// Start begins a new span. Parent is nil for a root span.
+	Start(parent Span, name string) Span
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+}
+
+// ContextWithSpan answers a context carrying the span and the tracer
+// that made it. Supply it in LockOpts.Context or UnlockOpts.Context
+// to make the span the parent of the spans for that call.
+func ContextWithSpan(ctx context.Context, t Tracer, s Span) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanContextKey{}, tracedSpan{t, s})
+}
+
+// StartSpan starts a child of the span carried by ctx. If ctx carries
+// no span I answer a span that does nothing, so backends can call this
+// unconditionally.
+func StartSpan(ctx context.Context, name string) Span {
+	if ctx == nil {
+		return noopSpan{}
+	}
+	ts, ok := ctx.Value(spanContextKey{}).(tracedSpan)
+	if !ok {
+		return noopSpan{}
+	}
+	return ts.tracer.Start(ts.span, name)
+}
+
+// ------------------------------------------------------------
+// TRACING-MIDDLEWARE
+
+// WithTracing answers a middleware that creates a span for every call.
+// Lock and Unlock spans are children of any span in the opts Context,
+// and are themselves placed in the Context handed to the wrapped
+// service, so backends can add child spans with StartSpan.
+func WithTracing(t Tracer, backend string) Middleware {
+	return func(next Service) Service {
+		return preserve(&tracingService{next: next, tracer: t, backend: backend}, next)
+	}
+}
+
+type tracingService struct {
+	next    Service
+	tracer  Tracer
+	backend string
+}
+
+func (s *tracingService) Lock(req LockRequest, opts *LockOpts) (LockResponse, error) {
+	o := LockOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	span, ctx := s.start(o.Context, "lid.Lock")
+	defer span.End()
+	span.SetAttribute(SignatureAttr, req.Signature)
+	span.SetAttribute(SigneeAttr, req.Signee)
+	span.SetAttribute(LevelAttr, req.Level)
+	o.Context = ctx
+
+	resp, err := s.next.Lock(req, &o)
+	span.SetAttribute(StatusAttr, resp.Status.String())
+	if resp.PreviousSignee != "" {
+		span.SetAttribute(PreviousSigneeAttr, resp.PreviousSignee)
+	}
+	if err != nil {
+		span.SetError(err)
+	}
+	return resp, err
+}
+
+func (s *tracingService) Unlock(req UnlockRequest, opts *UnlockOpts) (UnlockResponse, error) {
+	o := UnlockOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	span, ctx := s.start(o.Context, "lid.Unlock")
+	defer span.End()
+	span.SetAttribute(SignatureAttr, req.Signature)
+	span.SetAttribute(SigneeAttr, req.Signee)
+	o.Context = ctx
+
+	resp, err := s.next.Unlock(req, &o)
+	span.SetAttribute(StatusAttr, resp.Status.String())
+	if err != nil {
+		span.SetError(err)
+	}
+	return resp, err
+}
+
+// Check has no options to carry a context, so its span is
+// always a root, and the backend's requests aren't traced.
+func (s *tracingService) Check(signature string) (CheckResponse, error) {
+	span, _ := s.start(nil, "lid.Check")
+	defer span.End()
+	span.SetAttribute(SignatureAttr, signature)
+
+	resp, err := s.next.Check(signature)
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetAttribute(SigneeAttr, resp.Signee)
+		span.SetAttribute(LevelAttr, resp.Level)
+	}
+	return resp, err
+}
+
+func (s *tracingService) Unwrap() Service {
+	return s.next
+}
+
+// start answers a new span, parented to any span in ctx, and
+// a context carrying the new span.
+func (s *tracingService) start(ctx context.Context, name string) (Span, context.Context) {
+	var parent Span
+	if ctx != nil {
+		if ts, ok := ctx.Value(spanContextKey{}).(tracedSpan); ok {
+			parent = ts.span
+		}
+	}
+	span := s.tracer.Start(parent, name)
+	span.SetAttribute(BackendAttr, s.backend)
+	return span, ContextWithSpan(ctx, s.tracer, span)
+}
+
+// ------------------------------------------------------------
+// RECORDING-TRACER
+
+// RecordingTracer is a Tracer that keeps every span in memory.
+// It's intended for testing.
+type RecordingTracer struct {
+	mutex  sync.Mutex
+	spans  []*RecordedSpan
+	nextID int
+}
+
+// NewRecordingTracer answers a new, empty RecordingTracer.
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+func (t *RecordingTracer) Start(parent Span, name string) Span {
+	defer lock.Locker(&t.mutex).Unlock()
+	t.nextID++
+	s := &RecordedSpan{ID: t.nextID, Name: name, Attributes: make(map[string]interface{}), StartTime: time.Now(), tracer: t}
+	if p, ok := parent.(*RecordedSpan); ok {
+		s.ParentID = p.ID
+	}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+// Spans answers a copy of every span that has ended, in the order
+// they were started.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	defer lock.Locker(&t.mutex).Unlock()
+	var spans []RecordedSpan
+	for _, s := range t.spans {
+		if !s.Ended {
+			continue
+		}
+		c := *s
+		c.Attributes = make(map[string]interface{})
+		for k, v := range s.Attributes {
+			c.Attributes[k] = v
+		}
+		c.tracer = nil
+		spans = append(spans, c)
+	}
+	return spans
+}
+
+// RecordedSpan is the span created by a RecordingTracer.
+type RecordedSpan struct {
+	ID         int
+	ParentID   int // Zero for a root span
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	StartTime  time.Time
+	EndTime    time.Time
+	Ended      bool
+
+	tracer *RecordingTracer
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	defer lock.Locker(&s.tracer.mutex).Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *RecordedSpan) SetError(err error) {
+	defer lock.Locker(&s.tracer.mutex).Unlock()
+	s.Err = err
+}
+
+func (s *RecordedSpan) End() {
+	defer lock.Locker(&s.tracer.mutex).Unlock()
+	if !s.Ended {
+		s.EndTime = time.Now()
+		s.Ended = true
+	}
+}
+
+// ------------------------------------------------------------
+// BOILERPLATE
+
+type spanContextKey struct{}
+
+type tracedSpan struct {
+	tracer Tracer
+	span   Span
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) SetError(err error)                         {}
+func (noopSpan) End()                                       {}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+// The span attributes set by the tracing middleware.
+const (
+	BackendAttr        = "lid.backend"
+	LevelAttr          = "lid.level"
+	PreviousSigneeAttr = "lid.previous_signee"
+	SignatureAttr      = "lid.signature"
+	SigneeAttr         = "lid.signee"
+	StatusAttr         = "lid.status"
+)
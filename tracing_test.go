@@ -0,0 +1,52 @@
+package lid_test
+
+import (
+	"context"
+	"github.com/hackborn/lid"
+	"github.com/hackborn/lid/mem"
+	"testing"
+	"time"
+)
+
+// TestTracing verifies the spans made by the tracing middleware,
+// including parenting to a caller's span.
+func TestTracing(t *testing.T) {
+	tracer := lid.NewRecordingTracer()
+	s, err := lidmem.NewService(lid.ServiceOpts{Duration: time.Second * 10})
+	lid.MustErr(err)
+	s = lid.WithTracing(tracer, "mem")(s)
+
+	root := tracer.Start(nil, "request")
+	ctx := lid.ContextWithSpan(context.Background(), tracer, root)
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "0", Level: 2}, &lid.LockOpts{Context: ctx})
+	s.Lock(lid.LockRequest{Signature: "a", Signee: "1"}, nil)
+	s.Unlock(lid.UnlockRequest{Signature: "a", Signee: "0"}, &lid.UnlockOpts{Context: ctx})
+	s.Check("a")
+	root.End()
+
+	spans := tracer.Spans()
+	if len(spans) != 5 {
+		t.Fatal("expected 5 spans but have", len(spans))
+	}
+	want := []struct {
+		Name     string
+		ParentID int
+		Status   interface{}
+		Err      error
+	}{
+		{"request", 0, nil, nil},
+		{"lid.Lock", spans[0].ID, "LockOk", nil},
+		{"lid.Lock", 0, "LockFailed", lid.ErrForbidden},
+		{"lid.Unlock", spans[0].ID, "UnlockOk", nil},
+		{"lid.Check", 0, nil, lid.ErrNotFound},
+	}
+	for i, w := range want {
+		have := spans[i]
+		if have.Name != w.Name || have.ParentID != w.ParentID || have.Attributes[lid.StatusAttr] != w.Status || have.Err != w.Err {
+			t.Fatal("mismatch at", i, "have", have, "want", w)
+		}
+	}
+	if spans[1].Attributes[lid.SignatureAttr] != "a" || spans[1].Attributes[lid.LevelAttr] != 2 || spans[1].Attributes[lid.BackendAttr] != "mem" {
+		t.Fatal("missing lock attributes", spans[1].Attributes)
+	}
+}